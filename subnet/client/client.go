@@ -5,8 +5,15 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
 	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/json"
 	"github.com/ava-labs/avalanchego/utils/rpc"
+	"github.com/gorilla/websocket"
 	"github.com/red-dev-inc/zavax-oracle/tree/main/subnet/zavax"
 )
 
@@ -17,17 +24,76 @@ type Client interface {
 
 	GetBlockByHeight(ctx context.Context, blockID uint64) (uint64, zavax.ZcashBlock, uint64, ids.ID, ids.ID, error)
 
+	// WaitBlockByHeight fetches the block attesting the Zcash block at
+	// height, waiting up to timeout for it to be attested if it isn't yet
+	WaitBlockByHeight(ctx context.Context, height uint64, timeout time.Duration) (*zavax.GetBlockReply, error)
+
+	// GetRequestStatus returns the status of the attestation requested for
+	// a Zcash height
+	GetRequestStatus(ctx context.Context, height uint64) (*zavax.GetRequestStatusReply, error)
+
+	// SubscribeBlocks streams the accepted blocks attesting a Zcash height
+	// within [from, to], zero meaning unbounded, until ctx is done or the
+	// connection is closed
+	SubscribeBlocks(ctx context.Context, from uint64, to uint64) (<-chan zavax.GetBlockReply, error)
+
+	// GetBlocksByHeights fetches the blocks attesting the Zcash heights
+	GetBlocksByHeights(ctx context.Context, heights []uint64) (*zavax.GetBlocksReply, error)
+
+	// GetBlockRange fetches a page of the blocks attesting the Zcash heights
+	// from start to end, zero meaning the highest attested height
+	GetBlockRange(ctx context.Context, start uint64, end uint64, limit uint32) (*zavax.GetBlocksReply, error)
+
+	// ListBlocks fetches a page of the accepted blocks from the block height
+	// cursor
+	ListBlocks(ctx context.Context, cursor uint64, limit uint32) (*zavax.GetBlocksReply, error)
+
+	// GetBlockByZcashHash fetches the block attesting the Zcash block hash
+	GetBlockByZcashHash(ctx context.Context, hash string) (*zavax.GetBlockReply, error)
+
+	// GetBlockByTxID fetches the block attesting the Zcash block including
+	// the transaction
+	GetBlockByTxID(ctx context.Context, txID string) (*zavax.GetBlockReply, error)
+
+	// GetTxInclusionProof fetches the Merkle branch of a Zcash transaction in
+	// its attested block, to be checked with VerifyTxInclusionProof
+	GetTxInclusionProof(ctx context.Context, txID string) (*zavax.GetTxInclusionProofReply, error)
+
+	// GetStatus fetches how far the attestations are behind the Zcash tip
+	GetStatus(ctx context.Context) (*zavax.GetStatusReply, error)
+
 	ReconcileBlocks(ctx context.Context) ([]uint64, error)
 
+	// GetHeaderChainGaps reports the gaps and breaks in the attested Zcash
+	// header chain
+	GetHeaderChainGaps(ctx context.Context) (*zavax.GetHeaderChainGapsReply, error)
+
+	// GetReorgs lists the Zcash reorgs that replaced attested Zcash blocks
+	GetReorgs(ctx context.Context) ([]zavax.ReorgReply, error)
+
+	// StartReconcile starts a background reconcile job of the Zcash heights
+	// from start to end, zero meaning the default bounds
+	StartReconcile(ctx context.Context, start uint64, end uint64, workers uint32) (*zavax.ReconcileJobReply, error)
+
+	// GetReconcileJob returns the progress of a reconcile job
+	GetReconcileJob(ctx context.Context, jobID ids.ID) (*zavax.ReconcileJobReply, error)
+
+	// CancelReconcile stops a running reconcile job
+	CancelReconcile(ctx context.Context, jobID ids.ID) (*zavax.ReconcileJobReply, error)
+
+	// GetReconcileReport returns the mismatches found by a reconcile job
+	GetReconcileReport(ctx context.Context, jobID ids.ID) (*zavax.GetReconcileReportReply, error)
+
 }
 
 // New creates a new client object.
 func New(uri string, tracker *zavax.RequestTracker) Client {
 	req := rpc.NewEndpointRequester(uri)
-	return &client{req: req, tracker: tracker}
+	return &client{uri: uri, req: req, tracker: tracker}
 }
 
 type client struct {
+	uri string
 	req rpc.EndpointRequester
 	tracker *zavax.RequestTracker
 }
@@ -60,6 +126,147 @@ func (cli *client) GetBlockByHeight(ctx context.Context, id uint64) (uint64, zav
 	return uint64(resp.Timestamp), resp.Data, uint64(resp.Height), resp.ID, resp.ParentID, nil
 }
 
+func (cli *client) WaitBlockByHeight(ctx context.Context, height uint64, timeout time.Duration) (*zavax.GetBlockReply, error) {
+	resp := new(zavax.GetBlockReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getBlockByHeight",
+		&zavax.QueryDataArgs{
+			ID:      height,
+			Wait:    true,
+			Timeout: zavax.Duration{Duration: timeout},
+		},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetRequestStatus(ctx context.Context, height uint64) (*zavax.GetRequestStatusReply, error) {
+	resp := new(zavax.GetRequestStatusReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getRequestStatus",
+		&zavax.RequestStatusArgs{Height: json.Uint64(height)},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) SubscribeBlocks(ctx context.Context, from uint64, to uint64) (<-chan zavax.GetBlockReply, error) {
+	query := url.Values{}
+	if from != 0 {
+		query.Set("from", fmt.Sprint(from))
+	}
+	if to != 0 {
+		query.Set("to", fmt.Sprint(to))
+	}
+	feedURL := "ws" + strings.TrimPrefix(cli.uri, "http") + zavax.FeedEndpoint + "?" + query.Encode()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make(chan zavax.GetBlockReply)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(replies)
+		for {
+			var reply zavax.GetBlockReply
+			if err := conn.ReadJSON(&reply); err != nil {
+				return
+			}
+			select {
+			case replies <- reply:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return replies, nil
+}
+
+func (cli *client) GetBlocksByHeights(ctx context.Context, heights []uint64) (*zavax.GetBlocksReply, error) {
+	args := &zavax.GetBlocksByHeightsArgs{Heights: make([]json.Uint64, len(heights))}
+	for i, height := range heights {
+		args.Heights[i] = json.Uint64(height)
+	}
+	resp := new(zavax.GetBlocksReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getBlocksByHeights",
+		args,
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetBlockRange(ctx context.Context, start uint64, end uint64, limit uint32) (*zavax.GetBlocksReply, error) {
+	resp := new(zavax.GetBlocksReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getBlockRange",
+		&zavax.GetBlockRangeArgs{
+			Start: json.Uint64(start),
+			End:   json.Uint64(end),
+			Limit: json.Uint32(limit),
+		},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) ListBlocks(ctx context.Context, cursor uint64, limit uint32) (*zavax.GetBlocksReply, error) {
+	resp := new(zavax.GetBlocksReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.listBlocks",
+		&zavax.ListBlocksArgs{
+			Cursor: json.Uint64(cursor),
+			Limit:  json.Uint32(limit),
+		},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetBlockByZcashHash(ctx context.Context, hash string) (*zavax.GetBlockReply, error) {
+	resp := new(zavax.GetBlockReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getBlockByZcashHash",
+		&zavax.GetBlockByZcashHashArgs{Hash: hash},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetBlockByTxID(ctx context.Context, txID string) (*zavax.GetBlockReply, error) {
+	resp := new(zavax.GetBlockReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getBlockByTxID",
+		&zavax.GetBlockByTxIDArgs{TxID: txID},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetTxInclusionProof(ctx context.Context, txID string) (*zavax.GetTxInclusionProofReply, error) {
+	resp := new(zavax.GetTxInclusionProofReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getTxInclusionProof",
+		&zavax.GetTxInclusionProofArgs{TxID: txID},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetStatus(ctx context.Context) (*zavax.GetStatusReply, error) {
+	resp := new(zavax.GetStatusReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getStatus",
+		struct{}{},
+		resp,
+	)
+	return resp, err
+}
+
 func (cli *client) ReconcileBlocks(ctx context.Context) ([]uint64, error) {
 	resp := new(zavax.GetReconcileReply)
 	err := cli.req.SendRequest(ctx,
@@ -73,3 +280,67 @@ func (cli *client) ReconcileBlocks(ctx context.Context) ([]uint64, error) {
 	return resp.Height, nil
 }
 
+
+func (cli *client) GetHeaderChainGaps(ctx context.Context) (*zavax.GetHeaderChainGapsReply, error) {
+	resp := new(zavax.GetHeaderChainGapsReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getHeaderChainGaps",
+		struct{}{},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetReorgs(ctx context.Context) ([]zavax.ReorgReply, error) {
+	resp := new(zavax.GetReorgsReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getReorgs",
+		struct{}{},
+		resp,
+	)
+	return resp.Reorgs, err
+}
+
+func (cli *client) StartReconcile(ctx context.Context, start uint64, end uint64, workers uint32) (*zavax.ReconcileJobReply, error) {
+	resp := new(zavax.ReconcileJobReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.startReconcile",
+		&zavax.StartReconcileArgs{
+			Start:   json.Uint64(start),
+			End:     json.Uint64(end),
+			Workers: json.Uint32(workers),
+		},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetReconcileJob(ctx context.Context, jobID ids.ID) (*zavax.ReconcileJobReply, error) {
+	resp := new(zavax.ReconcileJobReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getReconcileJob",
+		&zavax.ReconcileJobArgs{JobID: jobID},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) CancelReconcile(ctx context.Context, jobID ids.ID) (*zavax.ReconcileJobReply, error) {
+	resp := new(zavax.ReconcileJobReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.cancelReconcile",
+		&zavax.ReconcileJobArgs{JobID: jobID},
+		resp,
+	)
+	return resp, err
+}
+
+func (cli *client) GetReconcileReport(ctx context.Context, jobID ids.ID) (*zavax.GetReconcileReportReply, error) {
+	resp := new(zavax.GetReconcileReportReply)
+	err := cli.req.SendRequest(ctx,
+		"zavax.getReconcileReport",
+		&zavax.ReconcileJobArgs{JobID: jobID},
+		resp,
+	)
+	return resp, err
+}
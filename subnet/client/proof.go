@@ -0,0 +1,41 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/red-dev-inc/zavax-oracle/tree/main/subnet/zavax"
+)
+
+// ErrInvalidProof is returned when a transaction inclusion proof doesn't hold
+var ErrInvalidProof = errors.New("invalid transaction inclusion proof")
+
+// VerifyTxInclusionProof checks offline that [proof], as returned by
+// GetTxInclusionProof, proves that the Zcash transaction [txID] is included in
+// the Zcash block of [txCount] transactions with the Merkle root [merkleRoot].
+// The root and the number of transactions should come from an attestation the
+// caller trusts, e.g. the data of the block at proof.Height, rather than from
+// the proof itself.
+func VerifyTxInclusionProof(txID string, merkleRoot string, txCount uint32, proof *zavax.GetTxInclusionProofReply) error {
+	if !strings.EqualFold(txID, proof.TxID) {
+		return fmt.Errorf("%w: proves transaction %s, expected %s", ErrInvalidProof, proof.TxID, txID)
+	}
+	if !strings.EqualFold(merkleRoot, proof.MerkleRoot) {
+		return fmt.Errorf("%w: proves merkle root %s, expected %s", ErrInvalidProof, proof.MerkleRoot, merkleRoot)
+	}
+	if uint32(proof.TxCount) != txCount {
+		return fmt.Errorf("%w: proves a block of %d transactions, expected %d", ErrInvalidProof, proof.TxCount, txCount)
+	}
+	root, err := zavax.ComputeMerkleRoot(strings.ToLower(txID), uint32(proof.Index), txCount, proof.Branch)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	if !strings.EqualFold(root, merkleRoot) {
+		return fmt.Errorf("%w: branch hashes to %s, expected %s", ErrInvalidProof, root, merkleRoot)
+	}
+	return nil
+}
@@ -273,10 +273,9 @@ done:
 	instances = make([]instance, len(uris))
 	for i := range uris {
 		u := uris[i] + fmt.Sprintf("/ext/bc/%s", blockchainID)
-		tracker:= zavax.NewRequestTracker()
 		instances[i] = instance{
 			uri: u,
-			cli: client.New(u, tracker),
+			cli: client.New(u, nil),
 		}
 	}
 })
@@ -0,0 +1,421 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+// zatoshis per ZEC
+const zatsPerZec = 100_000_000
+
+var (
+	errInvalidPayload      = errors.New("invalid attestation payload")
+	errNoAttestations      = errors.New("block doesn't attest any zcash block")
+	errMissingAttestation  = errors.New("attestation is missing the zcash block hash or height")
+	errHashMismatch        = errors.New("attested zcash block hash doesn't match")
+	errHeaderFieldMismatch = errors.New("attested zcash header field doesn't match")
+	errRootMismatch        = errors.New("attested zcash commitment root doesn't match")
+	errTxMismatch          = errors.New("attested zcash transactions don't match")
+	errValuePoolMismatch   = errors.New("attested zcash value pools don't match")
+)
+
+// Payload is the data of a block attesting Zcash blocks. It is serialized
+// with Codec, whose type ID identifies the payload version.
+type Payload interface {
+	ZcashBlocks() []*ZcashBlock
+}
+
+var (
+	_ Payload = &AttestationPayload{}
+	_ Payload = &CorrectionPayload{}
+	_ Payload = legacyPayload{}
+)
+
+// AttestationPayload is the first version of the block payload, a batch of
+// attested Zcash blocks
+type AttestationPayload struct {
+	Attestations []Attestation `serialize:"true" json:"attestations"`
+}
+
+// ZcashBlocks implements Payload
+func (p *AttestationPayload) ZcashBlocks() []*ZcashBlock {
+	zblocks := make([]*ZcashBlock, len(p.Attestations))
+	for i := range p.Attestations {
+		zblocks[i] = p.Attestations[i].ZcashBlock()
+	}
+	return zblocks
+}
+
+// CorrectionPayload re-attests Zcash heights whose attested block was
+// replaced by a Zcash reorg
+type CorrectionPayload struct {
+	Corrections []Correction `serialize:"true" json:"corrections"`
+}
+
+// ZcashBlocks implements Payload
+func (p *CorrectionPayload) ZcashBlocks() []*ZcashBlock {
+	zblocks := make([]*ZcashBlock, len(p.Corrections))
+	for i := range p.Corrections {
+		zblocks[i] = p.Corrections[i].Attestation.ZcashBlock()
+	}
+	return zblocks
+}
+
+// Correction attests the Zcash block that replaced the one attested at the
+// same height by the accepted block Supersedes
+type Correction struct {
+	Supersedes  ids.ID      `serialize:"true" json:"supersedes"`
+	Attestation Attestation `serialize:"true" json:"attestation"`
+}
+
+// legacyPayload is the data of the blocks built before Payload, JSON encoded
+// Zcash blocks. Only their stable fields are kept, as in an Attestation.
+type legacyPayload []*ZcashBlock
+
+// ZcashBlocks implements Payload
+func (p legacyPayload) ZcashBlocks() []*ZcashBlock {
+	return p
+}
+
+// Attestation holds the fields of a Zcash block that don't change once the
+// block is final. Fields like confirmations or nextblockhash, which differ
+// between zcashd nodes and over time, are left out so that every validator
+// encodes a Zcash block to the same bytes. Difficulty is left out as well,
+// it is derived from Bits.
+type Attestation struct {
+	Hash              string         `serialize:"true" json:"hash"`
+	Height            uint64         `serialize:"true" json:"height"`
+	Version           int64          `serialize:"true" json:"version"`
+	PreviousBlockHash string         `serialize:"true" json:"previousblockhash"`
+	MerkleRoot        string         `serialize:"true" json:"merkleroot"`
+	BlockCommitments  string         `serialize:"true" json:"blockcommitments"`
+	AuthDataRoot      string         `serialize:"true" json:"authdataroot"`
+	FinalSaplingRoot  string         `serialize:"true" json:"finalsaplingroot"`
+	ChainHistoryRoot  string         `serialize:"true" json:"chainhistoryroot"`
+	Time              int64          `serialize:"true" json:"time"`
+	Nonce             string         `serialize:"true" json:"nonce"`
+	Solution          string         `serialize:"true" json:"solution"`
+	Bits              string         `serialize:"true" json:"bits"`
+	ChainWork         string         `serialize:"true" json:"chainwork"`
+	Anchor            string         `serialize:"true" json:"anchor"`
+	Size              uint64         `serialize:"true" json:"size"`
+	Tx                []string       `serialize:"true" json:"tx"`
+	ChainSupply       AttestedPool   `serialize:"true" json:"chainSupply"`
+	ValuePools        []AttestedPool `serialize:"true" json:"valuePools"`
+}
+
+// AttestedPool is a Zcash value pool, or the chain supply when ID is empty.
+// Values are kept in zatoshis only.
+type AttestedPool struct {
+	ID            string `serialize:"true" json:"id"`
+	Monitored     bool   `serialize:"true" json:"monitored"`
+	ChainValueZat int64  `serialize:"true" json:"chainValueZat"`
+	ValueDeltaZat int64  `serialize:"true" json:"valueDeltaZat"`
+}
+
+// newAttestation returns the stable fields of [zblock]
+func newAttestation(zblock *ZcashBlock) Attestation {
+	a := Attestation{
+		Hash:              zblock.Hash,
+		Height:            uint64(zblock.Height),
+		Version:           int64(zblock.Version),
+		PreviousBlockHash: zblock.PreviousBlockHash,
+		MerkleRoot:        zblock.MerkleRoot,
+		BlockCommitments:  zblock.BlockCommitments,
+		AuthDataRoot:      zblock.AuthDataRoot,
+		FinalSaplingRoot:  zblock.FinalSaplingRoot,
+		ChainHistoryRoot:  zblock.ChainHistoryRoot,
+		Time:              int64(zblock.Time),
+		Nonce:             zblock.Nonce,
+		Solution:          zblock.Solution,
+		Bits:              zblock.Bits,
+		ChainWork:         zblock.ChainWork,
+		Anchor:            zblock.Anchor,
+		Size:              uint64(zblock.Size),
+		Tx:                zblock.Tx,
+		ChainSupply: AttestedPool{
+			Monitored:     zblock.ChainSupply.Monitored,
+			ChainValueZat: zblock.ChainSupply.ChainValueZat,
+			ValueDeltaZat: zblock.ChainSupply.ValueDeltaZat,
+		},
+		ValuePools: make([]AttestedPool, len(zblock.ValuePools)),
+	}
+	for i, pool := range zblock.ValuePools {
+		a.ValuePools[i] = AttestedPool{
+			ID:            pool.ID,
+			Monitored:     pool.Monitored,
+			ChainValueZat: pool.ChainValueZat,
+			ValueDeltaZat: pool.ValueDeltaZat,
+		}
+	}
+	return a
+}
+
+// ZcashBlock returns the attested Zcash block. Values in ZEC are derived
+// from the attested zatoshis.
+func (a *Attestation) ZcashBlock() *ZcashBlock {
+	zblock := &ZcashBlock{
+		Hash:              a.Hash,
+		Size:              int(a.Size),
+		Height:            int(a.Height),
+		Version:           int(a.Version),
+		MerkleRoot:        a.MerkleRoot,
+		BlockCommitments:  a.BlockCommitments,
+		AuthDataRoot:      a.AuthDataRoot,
+		FinalSaplingRoot:  a.FinalSaplingRoot,
+		ChainHistoryRoot:  a.ChainHistoryRoot,
+		Tx:                a.Tx,
+		Time:              int(a.Time),
+		Nonce:             a.Nonce,
+		Solution:          a.Solution,
+		Bits:              a.Bits,
+		ChainWork:         a.ChainWork,
+		Anchor:            a.Anchor,
+		PreviousBlockHash: a.PreviousBlockHash,
+		ChainSupply: ChainSupply{
+			Monitored:     a.ChainSupply.Monitored,
+			ChainValue:    zatsToZec(a.ChainSupply.ChainValueZat),
+			ChainValueZat: a.ChainSupply.ChainValueZat,
+			ValueDelta:    zatsToZec(a.ChainSupply.ValueDeltaZat),
+			ValueDeltaZat: a.ChainSupply.ValueDeltaZat,
+		},
+		ValuePools: make([]ValuePool, len(a.ValuePools)),
+	}
+	for i, pool := range a.ValuePools {
+		zblock.ValuePools[i] = ValuePool{
+			ID:            pool.ID,
+			Monitored:     pool.Monitored,
+			ChainValue:    zatsToZec(pool.ChainValueZat),
+			ChainValueZat: pool.ChainValueZat,
+			ValueDelta:    zatsToZec(pool.ValueDeltaZat),
+			ValueDeltaZat: pool.ValueDeltaZat,
+		}
+	}
+	return zblock
+}
+
+// Verify returns nil iff [a] has the hash and height of a Zcash block
+func (a *Attestation) Verify() error {
+	if a.Hash == "" || a.Height == 0 {
+		return fmt.Errorf("%w: hash %q at height %d", errMissingAttestation, a.Hash, a.Height)
+	}
+	return nil
+}
+
+// Compare returns an error wrapping the mismatch kind if [a] doesn't attest
+// the stable fields of [actual], the same Zcash block fetched from zcashd.
+// Every field of an Attestation is checked, since they are all served.
+func (a *Attestation) Compare(actual *Attestation) error {
+	checks := []struct {
+		err      error
+		field    string
+		attested interface{}
+		actual   interface{}
+	}{
+		{errHashMismatch, "hash", a.Hash, actual.Hash},
+		{errHeaderFieldMismatch, "height", a.Height, actual.Height},
+		{errHeaderFieldMismatch, "version", a.Version, actual.Version},
+		{errHeaderFieldMismatch, "previousblockhash", a.PreviousBlockHash, actual.PreviousBlockHash},
+		{errHeaderFieldMismatch, "time", a.Time, actual.Time},
+		{errHeaderFieldMismatch, "nonce", a.Nonce, actual.Nonce},
+		{errHeaderFieldMismatch, "solution", a.Solution, actual.Solution},
+		{errHeaderFieldMismatch, "bits", a.Bits, actual.Bits},
+		{errHeaderFieldMismatch, "chainwork", a.ChainWork, actual.ChainWork},
+		{errHeaderFieldMismatch, "size", a.Size, actual.Size},
+		{errRootMismatch, "merkleroot", a.MerkleRoot, actual.MerkleRoot},
+		{errRootMismatch, "blockcommitments", a.BlockCommitments, actual.BlockCommitments},
+		{errRootMismatch, "authdataroot", a.AuthDataRoot, actual.AuthDataRoot},
+		{errRootMismatch, "finalsaplingroot", a.FinalSaplingRoot, actual.FinalSaplingRoot},
+		{errRootMismatch, "chainhistoryroot", a.ChainHistoryRoot, actual.ChainHistoryRoot},
+		{errRootMismatch, "anchor", a.Anchor, actual.Anchor},
+		{errValuePoolMismatch, "chainSupply", a.ChainSupply, actual.ChainSupply},
+	}
+	for _, check := range checks {
+		if check.attested != check.actual {
+			return fmt.Errorf("%w: %s is %v but zcash has %v", check.err, check.field, check.attested, check.actual)
+		}
+	}
+
+	if len(a.Tx) != len(actual.Tx) {
+		return fmt.Errorf("%w: %d transactions but zcash has %d", errTxMismatch, len(a.Tx), len(actual.Tx))
+	}
+	for i := range a.Tx {
+		if a.Tx[i] != actual.Tx[i] {
+			return fmt.Errorf("%w: transaction %d is %s but zcash has %s", errTxMismatch, i, a.Tx[i], actual.Tx[i])
+		}
+	}
+
+	if len(a.ValuePools) != len(actual.ValuePools) {
+		return fmt.Errorf("%w: %d value pools but zcash has %d", errValuePoolMismatch, len(a.ValuePools), len(actual.ValuePools))
+	}
+	for i := range a.ValuePools {
+		if a.ValuePools[i] != actual.ValuePools[i] {
+			return fmt.Errorf("%w: value pool %d is %+v but zcash has %+v", errValuePoolMismatch, i, a.ValuePools[i], actual.ValuePools[i])
+		}
+	}
+	return nil
+}
+
+func zatsToZec(zats int64) float64 {
+	return float64(zats) / zatsPerZec
+}
+
+// attestationSize returns the number of bytes [a] adds to a payload
+func attestationSize(a *Attestation) (int, error) {
+	size, err := Codec.Size(CodecVersion, a)
+	if err != nil {
+		return 0, err
+	}
+	return size - wrappers.ShortLen, nil
+}
+
+// emptyPayloadSize is the size of a payload without attestations: the codec
+// version, the type ID and the length of the attestations
+const emptyPayloadSize = wrappers.ShortLen + wrappers.IntLen + wrappers.IntLen
+
+// correctionSize is the number of bytes a correction adds to the size of its
+// attestation
+const correctionSize = ids.IDLen
+
+// encodePayload returns the data of a block holding [payload]
+func encodePayload(payload Payload) ([]byte, error) {
+	return Codec.Marshal(CodecVersion, &payload)
+}
+
+// decodePayload parses a block's data. Blocks built before the codec payload
+// hold the JSON of a Zcash block or a JSON array of Zcash blocks, which
+// always start with a printable character rather than the codec version.
+func decodePayload(data []byte) (Payload, error) {
+	if isCodecPayload(data) {
+		var payload Payload
+		if _, err := Codec.Unmarshal(data, &payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+
+	raws, err := splitAttestations(data)
+	if err != nil {
+		return nil, err
+	}
+	zblocks := make(legacyPayload, len(raws))
+	for i, raw := range raws {
+		zblock, err := decodeZcashBlock(raw)
+		if err != nil {
+			return nil, err
+		}
+		attestation := newAttestation(zblock)
+		zblocks[i] = attestation.ZcashBlock()
+	}
+	return zblocks, nil
+}
+
+// isCodecPayload returns true if [data] holds a codec payload rather than
+// legacy JSON
+func isCodecPayload(data []byte) bool {
+	return len(data) > 0 && data[0] == 0
+}
+
+// decodeAttestations parses the Zcash blocks attested in a block's data
+func decodeAttestations(data []byte) ([]*ZcashBlock, error) {
+	payload, err := decodePayload(data)
+	if err != nil {
+		return nil, err
+	}
+	zblocks := payload.ZcashBlocks()
+	if len(zblocks) == 0 {
+		return nil, errNoAttestations
+	}
+	return zblocks, nil
+}
+
+// splitAttestations returns the JSON encoded Zcash blocks of legacy block
+// data, either a JSON array of Zcash blocks or a single Zcash block
+func splitAttestations(data []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return [][]byte{data}, nil
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(trimmed, &entries); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errNoAttestations
+	}
+	raws := make([][]byte, len(entries))
+	for i, entry := range entries {
+		raws[i] = entry
+	}
+	return raws, nil
+}
+
+// findAttestation returns the Zcash block at [height] attested in a block's
+// data, or nil if the block doesn't attest that height
+func findAttestation(data []byte, height uint64) (*ZcashBlock, error) {
+	zblocks, err := decodeAttestations(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, zblock := range zblocks {
+		if uint64(zblock.Height) == height {
+			return zblock, nil
+		}
+	}
+	return nil, nil
+}
+
+// attestationSet holds Zcash blocks by height and hash
+type attestationSet struct {
+	heights map[uint64]struct{}
+	hashes  map[string]struct{}
+}
+
+func newAttestationSet() *attestationSet {
+	return &attestationSet{
+		heights: make(map[uint64]struct{}),
+		hashes:  make(map[string]struct{}),
+	}
+}
+
+// Add adds [zblock] to the set
+func (s *attestationSet) Add(zblock *ZcashBlock) {
+	s.heights[uint64(zblock.Height)] = struct{}{}
+	if zblock.Hash != "" {
+		s.hashes[zblock.Hash] = struct{}{}
+	}
+}
+
+// HasHeight returns true if the set holds a Zcash block at [height]
+func (s *attestationSet) HasHeight(height uint64) bool {
+	_, ok := s.heights[height]
+	return ok
+}
+
+// Contains returns true if the set holds a Zcash block with the height or
+// the hash of [zblock]
+func (s *attestationSet) Contains(zblock *ZcashBlock) bool {
+	if _, ok := s.heights[uint64(zblock.Height)]; ok {
+		return true
+	}
+	_, ok := s.hashes[zblock.Hash]
+	return ok && zblock.Hash != ""
+}
+
+// decodeZcashBlock parses a single JSON encoded Zcash block
+func decodeZcashBlock(data []byte) (*ZcashBlock, error) {
+	zblock := &ZcashBlock{}
+	if err := json.Unmarshal(data, zblock); err != nil {
+		return nil, err
+	}
+	return zblock, nil
+}
@@ -9,12 +9,12 @@ import (
 	"fmt"
 	"time"
 
-	"encoding/json"
-
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/snow/choices"
 	"github.com/ava-labs/avalanchego/snow/consensus/snowman"
 	"github.com/ava-labs/avalanchego/utils/hashing"
+
+	log "github.com/inconshreveable/log15"
 )
 
 var (
@@ -23,10 +23,43 @@ var (
 	errTimestampTooLate  = errors.New("block's timestamp is more than 1 hour ahead of local time")
 	errBlockNotMatch     = errors.New("The zcash block queried is not match")
 	errBlockAlreadyReq   = errors.New("The zcash block queried is under consensus")
+	errBlockAbandoned    = errors.New("block was dropped before it was verified")
+	errBatchTooLarge     = errors.New("block attests too many zcash blocks")
+
+	// payloadErrors are the verify failures caused by the attested Zcash
+	// blocks themselves. Any other failure, e.g. this node's zcashd lagging
+	// behind or being unreachable, says nothing about them.
+	payloadErrors = []error{
+		errInvalidPayload,
+		errNoAttestations,
+		errMissingAttestation,
+		errBlockAlreadyReq,
+		errInvalidCorrection,
+		errHashMismatch,
+		errHeaderFieldMismatch,
+		errRootMismatch,
+		errTxMismatch,
+		errValuePoolMismatch,
+		errHeaderMismatch,
+		errInvalidZcashHeader,
+		errInvalidEquihashSolution,
+		errInvalidSolutionSize,
+		errInsufficientWork,
+	}
 
 	_ snowman.Block = &Block{}
 )
 
+// isPayloadError returns true if [err] is one of payloadErrors
+func isPayloadError(err error) bool {
+	for _, target := range payloadErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // Block is a block on the chain.
 // Each block contains:
 // 1) ParentID
@@ -48,8 +81,53 @@ type Block struct {
 // Verify returns nil iff this block is valid.
 // To be valid, it must be that:
 // b.parent.Timestamp < b.Timestamp <= [local time] + 1 hour
-func (b *Block) Verify(_ context.Context) error {
-	fmt.Printf("Verify block with zcash \n")
+func (b *Block) Verify(ctx context.Context) error {
+	log.Debug("Verifying block", "blkID", b.ID(), "height", b.Hght)
+	err := b.verify(ctx)
+	switch {
+	case err == nil:
+		b.vm.metrics.blocksVerified.Inc()
+		b.vm.tracker.Verified(b.ID(), b.zcashHeights())
+	case isPayloadError(err):
+		b.vm.metrics.verifyFailures.WithLabelValues(verifyFailureReason(err)).Inc()
+		// Don't build the invalid pending Zcash blocks of this block again
+		heights, dropErr := b.vm.mempool.Dropped(b.ID())
+		if dropErr != nil {
+			return dropErr
+		}
+		b.vm.tracker.Failed(heights, err)
+		b.vm.waiters.dropped(heights, fmt.Errorf("%w: %v", errAttestationDropped, err))
+	default:
+		b.vm.metrics.verifyFailures.WithLabelValues(verifyFailureReason(err)).Inc()
+		// This node couldn't check the pending Zcash blocks of this block,
+		// e.g. because its zcashd lags behind or is down. Build them again
+		// later.
+		heights := b.vm.mempool.Rejected(b.ID())
+		b.vm.tracker.Requeued(heights, err)
+	}
+	if commitErr := b.vm.state.Commit(); commitErr != nil {
+		return commitErr
+	}
+	return err
+}
+
+// zcashHeights returns the Zcash heights attested by [b]
+func (b *Block) zcashHeights() []uint64 {
+	if b.Hght == 0 {
+		return nil
+	}
+	payload, err := decodePayload(b.Dt)
+	if err != nil {
+		return nil
+	}
+	var heights []uint64
+	for _, zblock := range payload.ZcashBlocks() {
+		heights = append(heights, uint64(zblock.Height))
+	}
+	return heights
+}
+
+func (b *Block) verify(ctx context.Context) error {
 	// Get [b]'s parent
 	parentID := b.Parent()
 	parent, err := b.vm.getBlock(parentID)
@@ -57,21 +135,6 @@ func (b *Block) Verify(_ context.Context) error {
 		return errDatabaseGet
 	}
 
-	blockVal := b.Dt
-	blockStr := blockToString(blockVal)
-
-	if b.vm.mempoolSet == nil {
-		b.vm.mempoolSet = make(map[string]bool)
-	}
-
-	// Check if the block is already in the set
-	if _, exists := b.vm.mempoolSet[blockStr]; exists {
-		fmt.Printf("Duplicate height at verify \n")
-		return errBlockAlreadyReq // Block is a duplicate, do not add it
-	}
-
-	//b.vm.mempoolSet[blockStr] = true
-
 	// Ensure [b]'s height comes right after its parent's height
 	if expectedHeight := parent.Height() + 1; expectedHeight != b.Hght {
 		return fmt.Errorf(
@@ -92,18 +155,59 @@ func (b *Block) Verify(_ context.Context) error {
 		return errTimestampTooLate
 	}
 
-	zblock := ZcashBlock{}
-	err = json.Unmarshal(b.Dt, &zblock)
-	block, err := b.vm.queryZcashBlock(uint64(zblock.Height), true)
-
-	fmt.Printf("current zblock.Hash : %+v\n", zblock.Hash)
-	fmt.Printf("actual  zblock.Hash : %+v\n", block.Hash)
+	payload, err := decodePayload(b.Dt)
 	if err != nil {
-		return errBlockNotMatch
+		return fmt.Errorf("%w: %w: %w", errBlockNotMatch, errInvalidPayload, err)
+	}
+	// Legacy payloads hold unstable fields that verification doesn't check,
+	// so only the blocks that predate the codec payload may use them. The
+	// first codec payload of the chain closes the legacy format for all of
+	// its descendants, at the same height on every node.
+	if _, ok := payload.(legacyPayload); ok && parent.Hght > 0 && isCodecPayload(parent.Dt) {
+		return fmt.Errorf("%w: %w: legacy JSON payload after a codec payload", errBlockNotMatch, errInvalidPayload)
 	}
+	zblocks := payload.ZcashBlocks()
+	if len(zblocks) == 0 {
+		return fmt.Errorf("%w: %w", errBlockNotMatch, errNoAttestations)
+	}
+	if err := verifyBatch(len(zblocks), len(b.Dt)); err != nil {
+		return err
+	}
+	corrections, isCorrection := payload.(*CorrectionPayload)
 
-	if zblock.Hash != "" && zblock.Hash != block.Hash {
-		return errBlockNotMatch
+	// Zcash blocks attested by the processing ancestors of [b], and earlier
+	// in [b]
+	pending, err := b.vm.processingAttestations(b.Parent())
+	if err != nil {
+		return err
+	}
+	for i, zblock := range zblocks {
+		attestation := newAttestation(zblock)
+		if err := attestation.Verify(); err != nil {
+			return fmt.Errorf("%w: %w", errBlockNotMatch, err)
+		}
+
+		// Each Zcash height is only attested once, unless a Zcash reorg
+		// replaced the attested block
+		if isCorrection {
+			if err := b.vm.verifyCorrection(&corrections.Corrections[i], pending); err != nil {
+				return err
+			}
+		} else {
+			duplicate, err := b.vm.isDuplicateAttestation(zblock, pending)
+			if err != nil {
+				return err
+			}
+			if duplicate {
+				log.Debug("Block attests a zcash height twice", "blkID", b.ID(), "zcashHeight", zblock.Height)
+				return fmt.Errorf("%w: height %d", errBlockAlreadyReq, zblock.Height)
+			}
+		}
+
+		if err := b.verifyZcashBlock(ctx, zblock); err != nil {
+			return err
+		}
+		pending.Add(zblock)
 	}
 
 	// Put that block to verified blocks in memory
@@ -112,6 +216,44 @@ func (b *Block) Verify(_ context.Context) error {
 	return nil
 }
 
+// verifyBatch returns an error if a block attesting [count] Zcash blocks in
+// [size] bytes of data exceeds the protocol limits. A single Zcash block is
+// allowed to exceed MaxBlockDataSize, otherwise it could never be attested.
+// The Zcash blocks of a rejected batch are requeued, as this node builds
+// them into smaller blocks.
+func verifyBatch(count int, size int) error {
+	if count > MaxBlockAttestations {
+		return fmt.Errorf("%w: %d attestations, max %d", errBatchTooLarge, count, MaxBlockAttestations)
+	}
+	if count > 1 && size > MaxBlockDataSize {
+		return fmt.Errorf("%w: %d bytes, max %d", errBatchTooLarge, size, MaxBlockDataSize)
+	}
+	return nil
+}
+
+// verifyZcashBlock returns nil iff [zblock] matches the Zcash chain
+func (b *Block) verifyZcashBlock(ctx context.Context, zblock *ZcashBlock) error {
+	block, err := b.vm.queryZcashBlock(ctx, uint64(zblock.Height), true)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errBlockNotMatch, err)
+	}
+
+	log.Debug("Comparing attested zcash block", "zcashHeight", zblock.Height, "attested", zblock.Hash, "actual", block.Hash)
+
+	// Every stable field must match the Zcash block, not only its hash
+	attested, actual := newAttestation(zblock), newAttestation(block)
+	if err := attested.Compare(&actual); err != nil {
+		return fmt.Errorf("%w: %w", errBlockNotMatch, err)
+	}
+
+	// Check the attested header and its proof of work locally rather than
+	// trusting the zcash node
+	if err := b.vm.verifyZcashHeader(ctx, zblock); err != nil {
+		return fmt.Errorf("%w: %w", errBlockNotMatch, err)
+	}
+	return nil
+}
+
 // Initialize sets [b.bytes] to [bytes], [b.id] to hash([b.bytes]),
 // [b.status] to [status] and [b.vm] to [vm]
 func (b *Block) Initialize(bytes []byte, status choices.Status, vm *VM) {
@@ -124,28 +266,75 @@ func (b *Block) Initialize(bytes []byte, status choices.Status, vm *VM) {
 // Accept sets this block's status to Accepted and sets lastAccepted to this
 // block's ID and saves this info to b.vm.DB
 func (b *Block) Accept(_ context.Context) error {
-	fmt.Printf("Accept block with zcash: \n")
-	b.SetStatus(choices.Accepted) // Change state of this block
+	log.Debug("Accepting block", "blkID", b.ID(), "height", b.Hght)
 	blkID := b.ID()
 
+	// Never attest a Zcash height twice, unless correcting it. The genesis
+	// block doesn't attest one.
+	var (
+		zblocks        []*ZcashBlock
+		corrections    []Correction
+		originalHashes []string
+	)
+	if b.Hght > 0 {
+		payload, err := decodePayload(b.Dt)
+		if err != nil {
+			return err
+		}
+		zblocks = payload.ZcashBlocks()
+		if correction, ok := payload.(*CorrectionPayload); ok {
+			corrections = correction.Corrections
+		}
+		for i, zblock := range zblocks {
+			if corrections != nil {
+				original, err := b.vm.getAttestedZcashBlock(uint64(zblock.Height))
+				if err != nil {
+					return err
+				}
+				attestingID, err := b.vm.state.GetBlockIDByZcashHeight(uint64(zblock.Height))
+				if err != nil || original == nil || attestingID != corrections[i].Supersedes {
+					return fmt.Errorf("%w: height %d isn't attested by %s", errInvalidCorrection, zblock.Height, corrections[i].Supersedes)
+				}
+				originalHashes = append(originalHashes, original.Hash)
+				continue
+			}
+			attested, err := b.vm.isZcashBlockAttested(zblock)
+			if err != nil {
+				return err
+			}
+			if attested {
+				log.Warn("Accepted block attests a zcash height twice", "blkID", blkID, "zcashHeight", zblock.Height)
+				return fmt.Errorf("%w: height %d", errBlockAlreadyReq, zblock.Height)
+			}
+		}
+	}
+
+	b.SetStatus(choices.Accepted) // Change state of this block
+
 	// Persist data
 	if err := b.vm.state.PutBlock(b); err != nil {
 		return err
 	}
 
-	blockVal := b.Dt
-	blockStr := blockToString(blockVal)
-
-	if b.vm.mempoolSet == nil {
-		b.vm.mempoolSet = make(map[string]bool)
+	if err := b.vm.state.PutBlockIDAtHeight(b.Hght, blkID); err != nil {
+		return err
 	}
 
-	if _, exists := b.vm.mempoolSet[blockStr]; exists {
-		fmt.Printf("Duplicate height at accept \n")
-		return errBlockAlreadyReq // Block is a duplicate, do not add it
+	// Index the attested Zcash blocks
+	if err := b.indexAttestations(zblocks); err != nil {
+		return err
+	}
+	for i := range corrections {
+		if err := b.vm.supersede(&corrections[i], originalHashes[i], blkID, b.Tmstmp); err != nil {
+			return err
+		}
 	}
 
-	b.vm.mempoolSet[blockStr] = true // Add block to the set
+	heights := make([]uint64, len(zblocks))
+	for i, zblock := range zblocks {
+		heights[i] = uint64(zblock.Height)
+	}
+	b.vm.tracker.Accepted(blkID, heights)
 
 	// Set last accepted ID to this block ID
 	if err := b.vm.state.SetLastAccepted(blkID); err != nil {
@@ -156,23 +345,73 @@ func (b *Block) Accept(_ context.Context) error {
 	delete(b.vm.verifiedBlocks, b.ID())
 
 	// Commit changes to database
-	return b.vm.state.Commit()
+	if err := b.vm.state.Commit(); err != nil {
+		return err
+	}
+
+	// Wake up the callers waiting on the attested Zcash heights and push
+	// the block to the feed subscribers
+	b.vm.waiters.accepted(b, zblocks)
+	b.vm.feed.publish(b, zblocks)
+	b.vm.metrics.blocksAccepted.Inc()
+	return nil
+}
+
+// indexAttestations indexes [zblocks], the Zcash blocks attested by [b]
+func (b *Block) indexAttestations(zblocks []*ZcashBlock) error {
+	if len(zblocks) == 0 {
+		return nil
+	}
+	highest, err := b.vm.state.GetHighestZcashHeight()
+	if err != nil {
+		return err
+	}
+	for _, zblock := range zblocks {
+		if err := b.vm.state.PutZcashBlock(zblock, b.ID()); err != nil {
+			return err
+		}
+		if err := b.vm.mempool.Remove(uint64(zblock.Height)); err != nil {
+			return err
+		}
+		highest = max(highest, uint64(zblock.Height))
+	}
+	b.vm.mempool.Accepted(b.ID())
+	return b.vm.state.SetHighestZcashHeight(highest)
 }
 
 // Reject sets this block's status to Rejected and saves the status in state
 // Recall that b.vm.DB.Commit() must be called to persist to the DB
 func (b *Block) Reject(_ context.Context) error {
-	fmt.Printf("Reject block with zcash")
+	log.Debug("Rejecting block", "blkID", b.ID(), "height", b.Hght)
 	b.SetStatus(choices.Rejected) // Change state of this block
 	if err := b.vm.state.PutBlock(b); err != nil {
 		return err
 	}
 	// Delete this block from verified blocks as it's rejected
 	delete(b.vm.verifiedBlocks, b.ID())
+
+	// Build its pending Zcash blocks into another block
+	b.vm.mempool.Rejected(b.ID())
+	b.vm.tracker.Rejected(b.ID(), b.zcashHeights())
+	b.vm.metrics.blocksRejected.Inc()
+	if b.vm.mempool.Len() > 0 || b.isCorrection() {
+		b.vm.NotifyBlockReady()
+	}
 	// Commit changes to database
 	return b.vm.state.Commit()
 }
 
+// isCorrection returns true if [b] corrects attestations replaced by a Zcash
+// reorg
+func (b *Block) isCorrection() bool {
+	payload, err := decodePayload(b.Dt)
+	if err != nil {
+		return false
+	}
+	_, ok := payload.(*CorrectionPayload)
+	return ok
+}
+
 // ID returns the ID of this block
 func (b *Block) ID() ids.ID { return b.id }
 
@@ -4,13 +4,9 @@
 package zavax
 
 import (
-	"bytes"
-	"encoding/base64"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 
 	"github.com/ava-labs/avalanchego/cache"
 	"github.com/ava-labs/avalanchego/database"
@@ -80,16 +76,39 @@ type ZcashBlock struct {
 	NextBlockHash     string      `json:"nextblockhash"`
 }
 
+// HeaderChainGap is an inclusive range of Zcash heights without an accepted
+// attestation
+type HeaderChainGap struct {
+	Start uint64
+	End   uint64
+}
+
+// HeaderChainReport describes the Zcash header chain formed by the accepted
+// attestations
+type HeaderChainReport struct {
+	// Lowest and Highest attested Zcash heights, zero if nothing is attested
+	Lowest  uint64
+	Highest uint64
+	// Attested is the number of distinct attested Zcash heights
+	Attested uint64
+	// Gaps between Lowest and Highest, in ascending order
+	Gaps []HeaderChainGap
+	// Breaks are the attested heights whose previous block hash differs from
+	// the hash attested at the height below, in ascending order
+	Breaks []uint64
+}
+
 // BlockState defines methods to manage state with Blocks and LastAcceptedIDs.
 type BlockState interface {
 	GetBlock(blkID ids.ID) (*Block, error)
 	GetBlockIDAtHeight(height uint64) (ids.ID, error)
+	PutBlockIDAtHeight(height uint64, blkID ids.ID) error
 	GetBlockByHeight(ID uint64) (*Block, error)
 	PutBlock(blk *Block) error
 	GetLastAccepted() (ids.ID, error)
 	SetLastAccepted(ids.ID) error
-	QueryZcashBlock(ID uint64, validateConfirm bool) (*ZcashBlock, error)
-	ReconcileBlocks() ([]int, error)
+	QueryZcashBlock(ctx context.Context, height uint64, validateConfirm bool) (*ZcashBlock, error)
+	VerifyZcashHeader(ctx context.Context, zblock *ZcashBlock) error
 }
 
 // blockState implements BlocksState interface with database and cache.
@@ -99,30 +118,22 @@ type blockState struct {
 	// block database
 	blockDB      database.Database
 	lastAccepted ids.ID
+	// block height --> accepted block ID
+	heightDB database.Database
 
 	// vm reference
 	vm *VM
 }
 
-// GetBlockIDAtHeight implements BlockState.
+// GetBlockIDAtHeight returns the ID of the block accepted at [height], or
+// database.ErrNotFound if that height isn't indexed
 func (s *blockState) GetBlockIDAtHeight(height uint64) (ids.ID, error) {
-	if s.lastAccepted != ids.Empty {
-		return s.lastAccepted, nil
-	}
+	return getID(s.heightDB, heightKey(height))
+}
 
-	// get lastAccepted bytes from database with the fixed lastAcceptedKey
-	lastAcceptedBytes, err := s.blockDB.Get(lastAcceptedKey)
-	if err != nil {
-		return ids.ID{}, err
-	}
-	// parse bytes to ID
-	lastAccepted, err := ids.ToID(lastAcceptedBytes)
-	if err != nil {
-		return ids.ID{}, err
-	}
-	// put lastAccepted ID into memory
-	s.lastAccepted = lastAccepted
-	return lastAccepted, nil
+// PutBlockIDAtHeight indexes [blkID] as the block accepted at [height]
+func (s *blockState) PutBlockIDAtHeight(height uint64, blkID ids.ID) error {
+	return s.heightDB.Put(heightKey(height), blkID[:])
 }
 
 // blkWrapper wraps the actual blk bytes and status to persist them together
@@ -131,11 +142,12 @@ type blkWrapper struct {
 	Status choices.Status `serialize:"true"`
 }
 
-// NewBlockState returns BlockState with a new cache and given db
-func NewBlockState(db database.Database, vm *VM) BlockState {
+// NewBlockState returns BlockState with a new cache and given dbs
+func NewBlockState(db database.Database, heightDB database.Database, vm *VM) BlockState {
 	return &blockState{
 		blkCache: &cache.LRU[ids.ID, *Block]{Size: blockCacheSize},
 		blockDB:  db,
+		heightDB: heightDB,
 		vm:       vm,
 	}
 }
@@ -144,6 +156,7 @@ func NewBlockState(db database.Database, vm *VM) BlockState {
 func (s *blockState) GetBlock(blkID ids.ID) (*Block, error) {
 	// Check if cache has this blkID
 	if blk, cached := s.blkCache.Get(blkID); cached {
+		s.vm.metrics.blockCacheGets.WithLabelValues("hit").Inc()
 		// there is a key but value is nil, so return an error
 		if blk == nil {
 			return nil, database.ErrNotFound
@@ -152,6 +165,8 @@ func (s *blockState) GetBlock(blkID ids.ID) (*Block, error) {
 		return blk, nil
 	}
 
+	s.vm.metrics.blockCacheGets.WithLabelValues("miss").Inc()
+
 	// get block bytes from db with the blkID key
 	wrappedBytes, err := s.blockDB.Get(blkID[:])
 	if err != nil {
@@ -248,288 +263,59 @@ func (s *blockState) SetLastAccepted(lastAccepted ids.ID) error {
 	return s.blockDB.Put(lastAcceptedKey, lastAccepted[:])
 }
 
+// GetBlockByHeight returns the accepted block attesting the Zcash block at
+// [hgt], or nil if that height wasn't attested
 func (s *blockState) GetBlockByHeight(hgt uint64) (*Block, error) {
-
-	expectedHeight := hgt
-	result := 0
-
-	fmt.Printf("expectedHeight: %+v\n", hgt)
-
-	id, err := s.vm.state.GetLastAccepted()
-	fmt.Printf("GetLastAccepted: %+v\n", id)
-	zblock := ZcashBlock{}
+	id, err := s.vm.state.GetBlockIDByZcashHeight(hgt)
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	for int(expectedHeight) != result {
-		// Get the block from the database
-		//fmt.Printf("fetching last id: %+v\n",id)
-		block, err := s.vm.getBlock(id)
-		if err != nil {
-			return nil, err
-		}
-		// Convert JSON to struct
-		data := block.Data()
-		if len(data) != 0 {
-			json.Unmarshal(data, &zblock)
-			result = zblock.Height
-		}
-		id = block.PrntID
-		//fmt.Printf("id: %+v\n",id)
-		//fmt.Printf("result: %+v\n",result)
-
-		if int(expectedHeight) == result {
-			fmt.Printf("Block height matched %+v\n", int(expectedHeight) == result)
-			return block, nil
-		}
-
-		if block.Hght == 0 {
-			fmt.Printf("Block height is 0 hence break loop %+v\n", block.Hght)
-			break
-		}
-	}
-	//fmt.Printf("final zblock Hght: %+v\n",zblock.Height)
-	//#fmt.Printf("final expected: %+v\n",int(expectedHeight))
-	//fmt.Printf("final result: %+v\n",result)
-	if int(expectedHeight) != result {
-		fmt.Printf("final not match: %+v\n", result)
-		return nil, nil
-	}
-
-	return nil, nil
+	return s.vm.getBlock(id)
 }
 
-// GetBlock gets Block from either cache or database
-func (s *blockState) QueryZcashBlock(ID uint64, validateConfirm bool) (*ZcashBlock, error) {
-
-	confirmHeight := s.vm.config.BlockConfirmHeight
-	url := s.vm.config.Url
-	allowed := true
-	var isError error = nil
+// QueryZcashBlock fetches the Zcash block at [height] from the VM's
+// ZcashSource. If [validateConfirm] is set, the block must already have
+// BlockConfirmHeight confirmations.
+func (s *blockState) QueryZcashBlock(ctx context.Context, height uint64, validateConfirm bool) (*ZcashBlock, error) {
 	if validateConfirm {
-		allowed, isError = validateZcashBlockHeight(ID, confirmHeight, url)
-	}
-	if allowed {
-
-		hash, err := getZcashHash(ID, url)
-		payload := map[string]interface{}{
-			"jsonrpc": "1.0",
-			"id":      "curltest",
-			"method":  "getblock",
-			"params":  []interface{}{hash},
-		}
-
-		if err != nil {
-			return nil, errBlockHeightNotFound
-		}
-		jsonPayload, err := json.Marshal(payload)
-		if err != nil {
-			return nil, err
-		}
-
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-		if err != nil {
-			return nil, err
-		}
-
-		req.Header.Set("Content-Type", "text/plain")
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("zcash-user:Hw9!6an0i7c&")))
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
+		if err := s.validateZcashBlockHeight(ctx, height); err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
-
-		respBody, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-
-		var responseData struct {
-			Result *ZcashBlock `json:"result"`
-		}
-		err = json.Unmarshal(respBody, &responseData)
-		if err != nil {
-			return nil, err
-		}
-
-		block := responseData.Result
-
-		return block, nil
-	} else {
-		return nil, isError
-	}
-}
-
-func getZcashHash(hgt uint64, url string) (string, error) {
-
-	payload := map[string]interface{}{
-		"jsonrpc": "1.0",
-		"id":      "curltest",
-		"method":  "getblockhash",
-		"params":  []uint64{hgt},
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return "", errBlockHeightNotFound
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return "", errBlockHeightNotFound
 	}
 
-	req.Header.Set("Content-Type", "text/plain")
-	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("zcash-user:Hw9!6an0i7c&")))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", errBlockHeightNotFound
-	}
-	defer resp.Body.Close()
-
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", errBlockHeightNotFound
-	}
-
-	var responseData struct {
-		Result string `json:"result"`
-	}
-	err = json.Unmarshal(respBody, &responseData)
-	if err != nil {
-		return "", errBlockHeightNotFound
-	}
-
-	hash := responseData.Result
-	if hash == "" {
-		return "", errBlockHeightNotFound
+	hash, err := s.vm.zcash.GetBlockHash(ctx, height)
+	switch {
+	case errors.Is(err, errZcashUnavailable), errors.Is(err, errZcashTransient):
+		return nil, err
+	case err != nil:
+		return nil, errBlockHeightNotFound
 	}
-	return hash, nil
-
+	return s.vm.zcash.GetBlock(ctx, hash)
 }
 
-// validateZcashBlockHeight and return false if block is in latest 24
-func validateZcashBlockHeight(ID uint64, confirmHeight int, url string) (bool, error) {
-
-	// Given height should not be in the latest 24 block
-	excludeNoOfHeight := confirmHeight
-	payload := map[string]interface{}{
-		"jsonrpc": "1.0",
-		"id":      "curltest",
-		"method":  "getblockcount",
-		"params":  []uint64{},
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return false, err
-	}
-
-	req.Header.Set("Content-Type", "text/plain")
-	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("zcash-user:Hw9!6an0i7c&")))
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return false, err
-	}
-
-	var responseData struct {
-		LatestHeight int `json:"result"`
-	}
-	err = json.Unmarshal(respBody, &responseData)
+// VerifyZcashHeader fetches the raw header of [zblock] and checks that it
+// commits to the attested fields, hashes to zblock.Hash and carries a valid
+// proof of work.
+func (s *blockState) VerifyZcashHeader(ctx context.Context, zblock *ZcashBlock) error {
+	raw, err := s.vm.zcash.GetBlockHeader(ctx, zblock.Hash)
 	if err != nil {
-		return false, errBlockHeightNotAllowed
-	}
-	blockHeight := responseData.LatestHeight
-	if uint64(blockHeight) >= uint64(excludeNoOfHeight)+ID {
-		return true, nil
+		return err
 	}
-
-	return false, errBlockHeightNotFetch
+	return verifyZcashHeader(raw, zblock, s.vm.equihashN, s.vm.equihashK)
 }
 
-func (s *blockState) ReconcileBlocks() ([]int, error) {
-	var misMatchedHeights []int
-
-	id, err := s.vm.state.GetLastAccepted()
+// validateZcashBlockHeight returns an error if [height] is within the latest
+// BlockConfirmHeight blocks of the Zcash tip
+func (s *blockState) validateZcashBlockHeight(ctx context.Context, height uint64) error {
+	tip, err := s.vm.zcash.GetBlockCount(ctx)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("%w: %w", errBlockHeightNotFetch, err)
 	}
-	fmt.Printf("\nReconcile Start from GetLastAccepted: %+v\n", id)
-	zcashblock := ZcashBlock{}
-	confirmHeight := s.vm.config.BlockConfirmHeight
-	checkduplicate := make(map[string]uint64)
-	dup := 0
-	for i := 0; ; i++ {
-		zavaxblock, err := s.vm.getBlock(id)
-		if err != nil {
-			return nil, err
-		}
-		if zavaxblock == nil {
-			return nil, fmt.Errorf("zavaxblock is nil")
-		}
-
-		data := zavaxblock.Data()
-		// fmt.Printf("\nReading avalanche block height %v", zavaxblock.Hght)
-		if len(data) != 0 {
-			if err := json.Unmarshal(data, &zcashblock); err != nil {
-				return nil, fmt.Errorf("json unmarshal error: %v", err)
-			}
-
-			if zcashblock.Hash == "" || zcashblock.Height == 0 {
-				return nil, fmt.Errorf("zcashblock is missing valid data: %+v", zcashblock)
-			}
-
-			heightUint64 := uint64(zcashblock.Height)
-			blockStr := blockToString(data)
-
-			if existingId, exists := checkduplicate[blockStr]; exists {
-				dup++
-				fmt.Printf("\nDuplicate block for zavax height %v at avalanche height %v", existingId, zavaxblock.Hght)
-			} else {
-				checkduplicate[blockStr] = heightUint64
-			}
-
-			if heightUint64 > uint64(confirmHeight) {
-				latestZcashBlock, err := s.vm.queryZcashBlock(heightUint64, false)
-				if err != nil {
-					fmt.Printf("\nError reading %v", err)
-					return nil, err
-				}
-				if latestZcashBlock != nil && zcashblock.Hash != latestZcashBlock.Hash {
-					//fmt.Printf("\nReconcile mismatched Height: %+v", zcashblock.Height)
-					misMatchedHeights = append(misMatchedHeights, zcashblock.Height)
-				}
-			} else {
-				//fmt.Printf("\nzcashblock Height: %+v", heightUint64)
-				//fmt.Printf("\nExcluded due to minimum height confirmation: %+v\n", confirmHeight)
-			}
-		}
-
-		id = zavaxblock.PrntID
-
-		if zavaxblock.Hght == 0 {
-			fmt.Printf("\nBlock height is 0 hence break loop %+v", zavaxblock.Hght)
-			fmt.Printf("\nTotal blocks validated: %+v\n", i+1)
-			fmt.Printf("\nTotal duplicate: %+v\n", dup)
-			break
-		}
+	if tip < height+uint64(s.vm.config.BlockConfirmHeight) {
+		return errBlockHeightNotAllowed
 	}
-
-	return misMatchedHeights, nil
+	return nil
 }
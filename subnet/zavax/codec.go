@@ -6,11 +6,25 @@ package zavax
 import (
 	"github.com/ava-labs/avalanchego/codec"
 	"github.com/ava-labs/avalanchego/codec/linearcodec"
+	"github.com/ava-labs/avalanchego/utils/constants"
 )
 
 const (
 	// CodecVersion is the current default codec version
 	CodecVersion = 0
+
+	// MaxBlockSize is the maximum size of a serialized block, which must fit
+	// in a network message
+	MaxBlockSize = constants.DefaultMaxMessageSize
+
+	// MaxBlockAttestations is the maximum number of Zcash blocks attested by
+	// a single block. The maxBlockAttestations config only bounds the blocks
+	// this node builds.
+	MaxBlockAttestations = 64
+	// MaxBlockDataSize is the maximum size of the data of a block attesting
+	// more than one Zcash block, leaving room for the block fields around it.
+	// The maxBlockDataSize config only bounds the blocks this node builds.
+	MaxBlockDataSize = MaxBlockSize / 2
 )
 
 // Codecs do serialization and deserialization
@@ -21,7 +35,16 @@ var (
 func init() {
 	// Create default codec and manager
 	c := linearcodec.NewDefault()
-	Codec = codec.NewDefaultManager()
+	Codec = codec.NewManager(MaxBlockSize)
+
+	// Register the block payloads. New payload versions must be registered
+	// after the existing ones to keep their type IDs.
+	if err := c.RegisterType(&AttestationPayload{}); err != nil {
+		panic(err)
+	}
+	if err := c.RegisterType(&CorrectionPayload{}); err != nil {
+		panic(err)
+	}
 
 	// Register codec to manager with CodecVersion
 	if err := Codec.RegisterCodec(CodecVersion, c); err != nil {
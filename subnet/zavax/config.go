@@ -4,16 +4,205 @@
 package zavax
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
 	log "github.com/inconshreveable/log15"
 )
 
+var (
+	errInvalidQuorum    = errors.New("zcash quorum must be between 1 and the number of zcash endpoints")
+	errMissingURL       = errors.New("zcash endpoint url is required")
+	errInvalidFollow    = errors.New("follow interval must be positive")
+	errInvalidReorg     = errors.New("reorg interval and depth must be positive")
+	errInvalidBatch     = errors.New("block attestation and mempool limits must be positive")
+	errDataTooLarge     = errors.New("max block data size exceeds the protocol limit")
+	errAttestationLimit = errors.New("max block attestations exceeds the protocol limit")
+	errInvalidTTL       = errors.New("request status ttl must be positive")
+	errInvalidLimit     = errors.New("max query limit must be positive")
+)
+
 type Config struct {
-	BlockConfirmHeight       int `serialize:"true" json:"blockConfirmHeight"`
-	Url string `serialize:"true" json:"url"`
+	BlockConfirmHeight int    `serialize:"true" json:"blockConfirmHeight"`
+	Url                string `serialize:"true" json:"url"`
+
+	// Credentials used to authenticate against the zcashd at Url
+	ZcashCredentials
+
+	// ZcashEndpoints replaces Url with a set of independent zcashd nodes.
+	// A Zcash block is only accepted once ZcashQuorum of them agree on it.
+	ZcashEndpoints []ZcashEndpoint `serialize:"true" json:"zcashEndpoints"`
+	// ZcashQuorum defaults to a majority of ZcashEndpoints
+	ZcashQuorum int `serialize:"true" json:"zcashQuorum"`
+
+	// Timeouts, retries and circuit breaking of every zcashd
+	ZcashClientConfig
+
+	// StrictHeaderChain keeps this node from queueing or building an
+	// attestation of Zcash height H whose previous block hash differs from
+	// the attestation of H-1. Blocks built by other nodes aren't checked.
+	StrictHeaderChain bool `serialize:"true" json:"strictHeaderChain"`
+
+	// Automatic attestation of every final Zcash block
+	FollowerConfig
+
+	// Detection and correction of Zcash reorgs replacing attested blocks
+	ReorgConfig
+
+	// MaxBlockAttestations bounds the number of Zcash blocks attested by a
+	// single block this node builds, at most MaxBlockAttestations
+	MaxBlockAttestations int `serialize:"true" json:"maxBlockAttestations"`
+	// MaxBlockDataSize bounds the size of the data of a block this node
+	// builds attesting more than one Zcash block, at most MaxBlockDataSize
+	MaxBlockDataSize int `serialize:"true" json:"maxBlockDataSize"`
+
+	// MaxMempoolSize bounds the number of Zcash blocks waiting to be
+	// attested
+	MaxMempoolSize int `serialize:"true" json:"maxMempoolSize"`
+
+	// RequestStatusTTL is how long the status of an attestation requested
+	// through the API is kept after its last update
+	RequestStatusTTL Duration `serialize:"true" json:"requestStatusTTL"`
+
+	// MaxQueryLimit bounds the number of blocks returned by a single batch
+	// or range query
+	MaxQueryLimit int `serialize:"true" json:"maxQueryLimit"`
+
+	// MaxZcashLag is the number of final Zcash blocks above the highest
+	// attested height after which the node reports itself unhealthy. 0
+	// disables the check, as a node only attesting on request always lags.
+	MaxZcashLag uint64 `serialize:"true" json:"maxZcashLag"`
+}
+
+// FollowerConfig controls the background follower that attests Zcash blocks
+// once they have BlockConfirmHeight confirmations
+type FollowerConfig struct {
+	// FollowZcashTip enables the follower
+	FollowZcashTip bool `serialize:"true" json:"followZcashTip"`
+	// FollowInterval is the delay between two polls of the Zcash tip
+	FollowInterval Duration `serialize:"true" json:"followInterval"`
+	// FollowStartHeight is the first Zcash height the follower attests.
+	// Heights that are already attested are skipped. 0 starts at the first
+	// height above BlockConfirmHeight.
+	FollowStartHeight uint64 `serialize:"true" json:"followStartHeight"`
+}
+
+// ReorgConfig controls the background watcher that detects Zcash reorgs
+// replacing attested Zcash blocks and proposes corrections for them
+type ReorgConfig struct {
+	// WatchReorgs enables the watcher
+	WatchReorgs bool `serialize:"true" json:"watchReorgs"`
+	// ReorgInterval is the delay between two checks of the attested blocks
+	ReorgInterval Duration `serialize:"true" json:"reorgInterval"`
+	// ReorgDepth is the number of highest attested Zcash heights checked
+	ReorgDepth uint64 `serialize:"true" json:"reorgDepth"`
+}
+
+// ZcashClientConfig controls how requests to a zcashd are retried and when it
+// is considered down
+type ZcashClientConfig struct {
+	// RequestTimeout bounds a single attempt of a request
+	RequestTimeout Duration `serialize:"true" json:"zcashRequestTimeout"`
+	// MaxRetries is the number of times a transient failure is retried
+	MaxRetries int `serialize:"true" json:"zcashMaxRetries"`
+	// RetryBackoff is the delay before the first retry, it doubles on every
+	// following retry
+	RetryBackoff Duration `serialize:"true" json:"zcashRetryBackoff"`
+	// BreakerThreshold is the number of consecutive failed requests after
+	// which requests fail fast. 0 disables the circuit breaker.
+	BreakerThreshold int `serialize:"true" json:"zcashBreakerThreshold"`
+	// BreakerCooldown is how long requests fail fast before zcashd is tried
+	// again
+	BreakerCooldown Duration `serialize:"true" json:"zcashBreakerCooldown"`
+}
+
+// Duration is a time.Duration read from a string such as "10s"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
 }
 
 func (c *Config) SetDefaults() {
 	log.Info("Load default", "Version", "inside default")
 	c.BlockConfirmHeight = 24
 	c.Url = "http://127.0.0.1:8232/"
+	c.RequestTimeout = Duration{10 * time.Second}
+	c.MaxRetries = 3
+	c.RetryBackoff = Duration{250 * time.Millisecond}
+	c.BreakerThreshold = 5
+	c.BreakerCooldown = Duration{30 * time.Second}
+	c.FollowInterval = Duration{30 * time.Second}
+	c.ReorgInterval = Duration{5 * time.Minute}
+	c.ReorgDepth = 100
+	c.MaxBlockAttestations = 32
+	c.MaxBlockDataSize = 1 << 20
+	c.MaxMempoolSize = MaxMempoolSize
+	c.RequestStatusTTL = Duration{24 * time.Hour}
+	c.MaxQueryLimit = 100
+}
+
+// Verify returns an error if the config is invalid
+func (c *Config) Verify() error {
+	if err := c.ZcashCredentials.Verify(); err != nil {
+		return err
+	}
+	for i, endpoint := range c.ZcashEndpoints {
+		if endpoint.Url == "" {
+			return fmt.Errorf("%w: zcashEndpoints[%d]", errMissingURL, i)
+		}
+		if err := endpoint.ZcashCredentials.Verify(); err != nil {
+			return fmt.Errorf("zcashEndpoints[%d]: %w", i, err)
+		}
+	}
+	if len(c.ZcashEndpoints) > 0 && (c.quorum() < 1 || c.quorum() > len(c.ZcashEndpoints)) {
+		return errInvalidQuorum
+	}
+	if c.FollowZcashTip && c.FollowInterval.Duration <= 0 {
+		return errInvalidFollow
+	}
+	if c.WatchReorgs && (c.ReorgInterval.Duration <= 0 || c.ReorgDepth == 0) {
+		return errInvalidReorg
+	}
+	if c.MaxBlockAttestations < 1 || c.MaxBlockDataSize < 1 || c.MaxMempoolSize < 1 {
+		return errInvalidBatch
+	}
+	if c.RequestStatusTTL.Duration <= 0 {
+		return errInvalidTTL
+	}
+	if c.MaxQueryLimit < 1 {
+		return errInvalidLimit
+	}
+	if c.MaxBlockAttestations > MaxBlockAttestations {
+		return fmt.Errorf("%w: %d attestations, max %d", errAttestationLimit, c.MaxBlockAttestations, MaxBlockAttestations)
+	}
+	if c.MaxBlockDataSize > MaxBlockDataSize {
+		return fmt.Errorf("%w: %d bytes, max %d", errDataTooLarge, c.MaxBlockDataSize, MaxBlockDataSize)
+	}
+	return nil
+}
+
+// quorum returns the number of ZcashEndpoints that must agree
+func (c *Config) quorum() int {
+	if c.ZcashQuorum == 0 {
+		return len(c.ZcashEndpoints)/2 + 1
+	}
+	return c.ZcashQuorum
 }
@@ -0,0 +1,244 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Equihash parameters of Zcash mainnet and testnet, which the header of every
+// attested Zcash block must satisfy
+const (
+	EquihashN = 200
+	EquihashK = 9
+)
+
+var (
+	errInvalidEquihashParams   = errors.New("invalid equihash parameters")
+	errInvalidSolutionSize     = errors.New("equihash solution has an invalid size")
+	errInvalidEquihashSolution = errors.New("invalid equihash solution")
+)
+
+// verifyEquihash returns nil iff [solution] is a valid Equihash([n], [k])
+// solution for [input], which is the block header up to and including the
+// nonce. This follows the verification algorithm of section 7.6.1 of the
+// Zcash protocol specification.
+func verifyEquihash(n int, k int, input []byte, solution []byte) error {
+	if err := checkEquihashParams(n, k); err != nil {
+		return err
+	}
+	var (
+		collisionBits  = n / (k + 1)
+		numIndices     = 1 << k
+		hashLen        = n / 8
+		indicesPerHash = 512 / n
+	)
+	if len(solution)*8 != numIndices*(collisionBits+1) {
+		return errInvalidSolutionSize
+	}
+
+	indices := unpackIndices(solution, collisionBits+1)
+	person := equihashPersonalization(n, k)
+	digests := make(map[uint32][]byte)
+
+	// Every leaf of the tree is the [hashLen] byte slice of the hash of
+	// [input] and the leaf's index
+	type node struct {
+		hash    []byte
+		indices []uint32
+	}
+	nodes := make([]node, numIndices)
+	for i, index := range indices {
+		group := index / uint32(indicesPerHash)
+		digest, ok := digests[group]
+		if !ok {
+			msg := make([]byte, len(input)+4)
+			copy(msg, input)
+			binary.LittleEndian.PutUint32(msg[len(input):], group)
+			digest = blake2bPersonal(indicesPerHash*hashLen, person, msg)
+			digests[group] = digest
+		}
+		offset := int(index%uint32(indicesPerHash)) * hashLen
+		nodes[i] = node{
+			hash:    digest[offset : offset+hashLen],
+			indices: []uint32{index},
+		}
+	}
+
+	// Each round merges pairs of nodes that collide on the next
+	// [collisionBits] bits
+	for round := 1; len(nodes) > 1; round++ {
+		merged := make([]node, len(nodes)/2)
+		for i := range merged {
+			left, right := nodes[2*i], nodes[2*i+1]
+			if left.indices[0] >= right.indices[0] {
+				return fmt.Errorf("%w: indices out of order in round %d", errInvalidEquihashSolution, round)
+			}
+			hash := make([]byte, hashLen)
+			for j := range hash {
+				hash[j] = left.hash[j] ^ right.hash[j]
+			}
+			if !zeroBits(hash, (round-1)*collisionBits, round*collisionBits) {
+				return fmt.Errorf("%w: no collision in round %d", errInvalidEquihashSolution, round)
+			}
+			if !distinctIndices(left.indices, right.indices) {
+				return fmt.Errorf("%w: duplicate indices", errInvalidEquihashSolution)
+			}
+			merged[i] = node{
+				hash:    hash,
+				indices: append(append([]uint32{}, left.indices...), right.indices...),
+			}
+		}
+		nodes = merged
+	}
+
+	if !zeroBits(nodes[0].hash, 0, n) {
+		return fmt.Errorf("%w: final hash is not zero", errInvalidEquihashSolution)
+	}
+	return nil
+}
+
+// checkEquihashParams returns an error if Equihash([n], [k]) is not
+// supported
+func checkEquihashParams(n int, k int) error {
+	if n <= 0 || k <= 0 || n > 512 || n%8 != 0 || n%(k+1) != 0 || n/(k+1)+1 > 32 {
+		return fmt.Errorf("%w: n=%d k=%d", errInvalidEquihashParams, n, k)
+	}
+	return nil
+}
+
+// equihashPersonalization returns the BLAKE2b personalization of
+// Equihash([n], [k])
+func equihashPersonalization(n int, k int) [16]byte {
+	person := [16]byte{'Z', 'c', 'a', 's', 'h', 'P', 'o', 'W'}
+	binary.LittleEndian.PutUint32(person[8:], uint32(n))
+	binary.LittleEndian.PutUint32(person[12:], uint32(k))
+	return person
+}
+
+// unpackIndices splits [solution] into big endian integers of [bitLen] bits
+func unpackIndices(solution []byte, bitLen int) []uint32 {
+	indices := make([]uint32, len(solution)*8/bitLen)
+	for i := range indices {
+		var index uint32
+		for bit := i * bitLen; bit < (i+1)*bitLen; bit++ {
+			index = index<<1 | uint32(solution[bit/8]>>(7-bit%8)&1)
+		}
+		indices[i] = index
+	}
+	return indices
+}
+
+// zeroBits returns true if bits [from, to) of [b] are all zero, counting from
+// the most significant bit of the first byte
+func zeroBits(b []byte, from int, to int) bool {
+	for bit := from; bit < to; bit++ {
+		if b[bit/8]>>(7-bit%8)&1 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func distinctIndices(a []uint32, b []uint32) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var blake2bIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var blake2bSigma = [10][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+}
+
+// blake2bPersonal returns the unkeyed BLAKE2b digest of [data] with [size]
+// bytes of output and the given personalization. golang.org/x/crypto/blake2b
+// doesn't expose the personalization parameter that Equihash relies on.
+func blake2bPersonal(size int, person [16]byte, data []byte) []byte {
+	h := blake2bIV
+	h[0] ^= 0x01010000 ^ uint64(size)
+	h[6] ^= binary.LittleEndian.Uint64(person[:8])
+	h[7] ^= binary.LittleEndian.Uint64(person[8:])
+
+	var (
+		block   [128]byte
+		counter uint64
+	)
+	for len(data) > len(block) {
+		counter += uint64(len(block))
+		blake2bCompress(&h, data[:len(block)], counter, false)
+		data = data[len(block):]
+	}
+	copy(block[:], data)
+	counter += uint64(len(data))
+	blake2bCompress(&h, block[:], counter, true)
+
+	digest := make([]byte, 64)
+	for i, word := range h {
+		binary.LittleEndian.PutUint64(digest[i*8:], word)
+	}
+	return digest[:size]
+}
+
+func blake2bCompress(h *[8]uint64, block []byte, counter uint64, last bool) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+
+	var v [16]uint64
+	copy(v[:8], h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= counter
+	if last {
+		v[14] = ^v[14]
+	}
+
+	g := func(a, b, c, d int, x, y uint64) {
+		v[a] += v[b] + x
+		v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+		v[a] += v[b] + y
+		v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+		v[c] += v[d]
+		v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+	}
+	for round := 0; round < 12; round++ {
+		s := &blake2bSigma[round%10]
+		g(0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+
+	for i := range h {
+		h[i] ^= v[i] ^ v[i+8]
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Equihash parameters and an easy target used by the tests, matching regtest
+const (
+	testEquihashN = 48
+	testEquihashK = 5
+	testZcashBits = 0x207fffff
+)
+
+// Real Zcash headers with their 1344 byte Equihash (200, 9) solutions
+const (
+	// header of the Zcash mainnet genesis block,
+	// 00040fe8ec8471911baa1db1266ea15dd06b4a8a5c453883c000b031973dce08
+	zcashMainnetGenesisHeader = "" +
+		"040000000000000000000000000000000000000000000000000000000000000000000000db4d7a85b768123f1dff1d4c" +
+		"4cece70083b2d27e117b4ac2e31d087988a5eac400000000000000000000000000000000000000000000000000000000" +
+		"0000000090041358ffff071f5712000000000000000000000000000000000000000000000000000000000000fd400500" +
+		"0a889f00854b8665cd555f4656f68179d31ccadc1b1f7fb0952726313b16941da348284d67add4686121d4e3d930160c" +
+		"1348d8191c25f12b267a6a9c131b5031cbf8af1f79c9d513076a216ec87ed045fa966e01214ed83ca02dc1797270a454" +
+		"720d3206ac7d931a0a680c5c5e099057592570ca9bdf6058343958b31901fce1a15a4f38fd347750912e14004c73dfe5" +
+		"88b903b6c03166582eeaf30529b14072a7b3079e3a684601b9b3024054201f7440b0ee9eb1a7120ff43f713735494aa2" +
+		"7b1f8bab60d7f398bca14f6abb2adbf29b04099121438a7974b078a11635b594e9170f1086140b4173822dd697894483" +
+		"e1c6b4e8b8dcd5cb12ca4903bc61e108871d4d915a9093c18ac9b02b6716ce1013ca2c1174e319c1a570215bc9ab5f75" +
+		"64765f7be20524dc3fdf8aa356fd94d445e05ab165ad8bb4a0db096c097618c81098f91443c719416d39837af6de8501" +
+		"5dca0de89462b1d8386758b2cf8a99e00953b308032ae44c35e05eb71842922eb69797f68813b59caf266cb6c213569a" +
+		"e3280505421a7e3a0a37fdf8e2ea354fc5422816655394a9454bac542a9298f176e211020d63dee6852c40de02267e2f" +
+		"c9d5e1ff2ad9309506f02a1a71a0501b16d0d36f70cdfd8de78116c0c506ee0b8ddfdeb561acadf31746b5a9dd32c219" +
+		"30884397fb1682164cb565cc14e089d66635a32618f7eb05fe05082b8a3fae620571660a6b89886eac53dec109d7cbb6" +
+		"930ca698a168f301a950be152da1be2b9e07516995e20baceebecb5579d7cdbc16d09f3a50cb3c7dffe33f26686d4ff3" +
+		"f8946ee6475e98cf7b3cf9062b6966e838f865ff3de5fb064a37a21da7bb8dfd2501a29e184f207caaba364f36f2329a" +
+		"77515dcb710e29ffbf73e2bbd773fab1f9a6b005567affff605c132e4e4dd69f36bd201005458cfbd2c658701eb2a700" +
+		"251cefd886b1e674ae816d3f719bac64be649c172ba27a4fd55947d95d53ba4cbc73de97b8af5ed4840b659370c556e7" +
+		"376457f51e5ebb66018849923db82c1c9a819f173cccdb8f3324b239609a300018d0fb094adf5bd7cbb3834c69e6d0b3" +
+		"798065c525b20f040e965e1a161af78ff7561cd874f5f1b75aa0bc77f720589e1b810f831eac5073e6dd46d00a2793f7" +
+		"0f7427f0f798f2f53a67e615e65d356e66fe40609a958a05edb4c175bcc383ea0530e67ddbe479a898943c6e3074c6fc" +
+		"c252d6014de3a3d292b03f0d88d312fe221be7be7e3c59d07fa0f2f4029e364f1f355c5d01fa53770d0cd76d82bf7e60" +
+		"f6903bc1beb772e6fde4a70be51d9c7e03c8d6d8dfb361a234ba47c470fe630820bbd920715621b9fbedb49fcee165ea" +
+		"d0875e6c2b1af16f50b5d6140cc981122fcbcf7c5a4e3772b3661b628e08380abc545957e59f634705b1bbde2f0b4e05" +
+		"5a5ec5676d859be77e20962b645e051a880fddb0180b4555789e1f9344a436a84dc5579e2553f1e5fb0a599c137be36c" +
+		"abbed0319831fea3fddf94ddc7971e4bcf02cdc93294a9aab3e3b13e3b058235b4f4ec06ba4ceaa49d675b4ba80716f3" +
+		"bc6976b1fbf9c8bf1f3e3a4dc1cd83ef9cf816667fb94f1e923ff63fef072e6a19321e4812f96cb0ffa864da50ad74de" +
+		"b76917a336f31dce03ed5f0303aad5e6a83634f9fcc371096f8288b8f02ddded5ff1bb9d49331e4a84dbe1543164438f" +
+		"de9ad71dab024779dcdde0b6602b5ae0a6265c14b94edd83b37403f4b78fcd2ed555b596402c28ee81d87a909c4e8722" +
+		"b30c71ecdd861b05f61f8b1231795c76adba2fdefa451b283a5d527955b9f3de1b9828e7b2e74123dd47062ddcc09b05" +
+		"e7fa13cb2212a6fdbc65d7e852cec463ec6fd929f5b8483cf3052113b13dac91b69f49d1b7d1aec01c4a68e41ce157"
+
+	// header of the Zcash testnet block at height 380640,
+	// 000a5e44b3b238d0cc36de7c0cb1ae5ac6e16f8727173abd295a83ebfa073b91
+	zcashTestnetHeader380640 = "" +
+		"0400000006785624481f381e68b4506ba5d6cc53ddd6dc876cbc97e45e3c7c4a626a19008c450aa9112b2e900eba30c2" +
+		"e3b8428c23fb2a30bb7fa34a853c97f02fb1a2200d86a7943df2dc92fb8b131b0698db24dd01a12d19696c20443f5f63" +
+		"9df3ab5aecdc295c172c191f870000790c975f8c9f0a77f12ef1e021c6045c3c9acb7c432c2aa7ed42ad0000fd400500" +
+		"5db35c547608bbf32bd1b90369e6e0bc1e275a0d064f092b235835cb6dfc9158c6146a0e5cfbdf2d2f04f71478f7d921" +
+		"2bdeeb938029a5cc217ebf1f517711dbc7cb35d084328b8f7613e878f69e27b2b40e8103292cb87845006943b761bbbe" +
+		"43d94cfbf971011617965a7de1e846a586ad81f2ad138eb0fd74729efc04720badc95a1f1383cc70e890db91c143591a" +
+		"b96526263ec6b8a6186568dda29b9015078d19e87cbb2c00b26edee3e4b227ad6fa090db2d290191ef1043e2037fc0bd" +
+		"225e6a1364d16223b0234311e8c5ff455a0cc2e0c1f84944dfab49864f57e5ec2a2b5e91df5229449ee399b4c721abab" +
+		"63c534602abdf64d37f60905bea71cd59be759bae5967f6f3e1bf732753d4d9c1c11dcb5b6949bc4f63a06a3b0db5c2d" +
+		"eebab040c70fc55fc648bb2559fe2da2b4a4bd53ccbca7aaf03262cdf31c5bab90cdc151b686d3e5f8a29103b9346602" +
+		"b5394b245dc9655116d33c2ed9d31563bb74950d0927895a024c119d30d4f2c760c346b11108ab29db2931123aa36937" +
+		"cbd152756758e3d341ec40db1d1b539fcbefa2e76af9827f575025c58569fbec1f806607e03a6eabc228a900a18144e3" +
+		"10ab608a930ee6a10d5e6fc7ecc9934fb42b51f0a6552e2a1ba1d627b51df2d27889e14b87f093452b79bce3e2a74398" +
+		"f4b748eda48495b30437bef13527a231ce724f24d5bcf4040cc77f56dab50ff30ce12039ca968eef3c5ab44b2cdd8f7f" +
+		"ecb36ed39bc624807a4da49d5b2f53abeb1a027676fb500fb89d7092eef849f254dfd3a7325e4b810687b8567d7db8e7" +
+		"96480836bbeab2efff44bb0421f4e3d5d1493bedc2c331f75b7ba931e93495dc379fa22404a2e60919fb2644ee4e5c3b" +
+		"c2025fb17540dce5dede2fdc4fc6b87494ae26ae89bbe954ee8458740601a665126129c9962052683661efcfffce8303" +
+		"211fe3bf0adac14936927ce2f4b30a22227c39b4128616dfbfcaeae8f4a3b30255d215d1b9ccd9bff2173b5a94ffa547" +
+		"3bc49097030e782d81c1dc4f8c4a25803c6dd9a9e775646084ed2bbbf7457386ece058032128bc87c7b7772be513f791" +
+		"76241de701580b5c04f88ee81e231583528b514f0c478382e60d5741bd0b5582c2ece2767931f538d050498886814c5b" +
+		"27541764bda9734d5c46f2b3c80f2649d40374e45c053c050e33e83ed578f6d5c19435b7f495261e7e522d5225eaead3" +
+		"74497fed7c30e322d6acbf512751b58417120bf8d97fcfdaa5e3be842fc7beab85235ff7e9ee459b03ef2ae01ceff42e" +
+		"0621ddce403e65521505ed0b25fca1a0747263e44c72c5e1e95d85119a7956852c629fcb903b9589e768a6bcbec5358a" +
+		"5332368a6913ffb9b9880e8d3701c6a366bec102bab8c6d9e57b2287ede4774d69fe81af83dbd423c905f666170bfc03" +
+		"f360314edf3098fe2036634ad90f326a71faa5b70f245acbdf8f7d4481283819d8dae7823ac31bafef129b94822a4d94" +
+		"b8ea5773b7477269be9dbe3bc8c11886a2d2a8176658fe30e1ba1bdcf320873d1d2325096223af6e142818a2c370b844" +
+		"7db8e6e865fef2074596bc9e679b8c37c51e99c4f35ac8431303fac507193d1d162d309a3d8d6e57cf4cd429b34ce69f" +
+		"69ef2f1e728d7b9347051b46d4ba5a7e7f9d43963e960d0bbaf63eeb69396dc75b325f08e9243db0c678aa192eb3db32" +
+		"d9cf65a0a38bd5726e31380f2de23ea9a019d8496ab511df2d955978fcee6e331aeea5df0a1826639323180b87bbbf6a" +
+		"039e34f482a5e4eabc6d9a139c40e2840b40eb53dea3d549b54405ba7e1b392f308df2abfd6e97a3eb44f540b272a6d9" +
+		"7c085be2142445ea27349bc7a5493397ceee4c8016a38457480f4de263cd2c2416296a2d86c19ded93cf431bfdd1e3"
+)
+
+func TestBlake2bPersonal(t *testing.T) {
+	require := require.New(t)
+
+	// Without a personalization the digest must match the reference
+	// implementation
+	for _, size := range []int{0, 1, 127, 128, 129, 256, 1000} {
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		expected := blake2b.Sum512(data)
+		require.Equal(expected[:], blake2bPersonal(64, [16]byte{}, data))
+
+		hasher, err := blake2b.New(50, nil)
+		require.NoError(err)
+		_, err = hasher.Write(data)
+		require.NoError(err)
+		require.Equal(hasher.Sum(nil), blake2bPersonal(50, [16]byte{}, data))
+	}
+
+	// The personalization changes the digest
+	require.NotEqual(
+		blake2bPersonal(50, [16]byte{}, nil),
+		blake2bPersonal(50, equihashPersonalization(200, 9), nil),
+	)
+}
+
+func TestVerifyEquihash(t *testing.T) {
+	require := require.New(t)
+
+	input := make([]byte, zcashHeaderPrefixLen)
+	var solution []uint32
+	for nonce := uint32(0); solution == nil; nonce++ {
+		binary.LittleEndian.PutUint32(input[108:], nonce)
+		if solutions := solveEquihash(testEquihashN, testEquihashK, input); len(solutions) > 0 {
+			solution = solutions[0]
+		}
+	}
+	bitLen := testEquihashN/(testEquihashK+1) + 1
+	require.NoError(verifyEquihash(testEquihashN, testEquihashK, input, packIndices(solution, bitLen)))
+
+	// A different input doesn't collide
+	otherInput := bytes.Clone(input)
+	otherInput[0] ^= 1
+	require.ErrorIs(verifyEquihash(testEquihashN, testEquihashK, otherInput, packIndices(solution, bitLen)), errInvalidEquihashSolution)
+
+	// Swapping two subtrees breaks the index ordering
+	swapped := append(append([]uint32{}, solution[1]), solution[0])
+	swapped = append(swapped, solution[2:]...)
+	require.ErrorIs(verifyEquihash(testEquihashN, testEquihashK, input, packIndices(swapped, bitLen)), errInvalidEquihashSolution)
+
+	// Truncated solutions are rejected
+	require.ErrorIs(verifyEquihash(testEquihashN, testEquihashK, input, packIndices(solution, bitLen)[1:]), errInvalidSolutionSize)
+
+	require.ErrorIs(verifyEquihash(200, 6, input, nil), errInvalidEquihashParams)
+}
+
+func TestVerifyZcashHeader(t *testing.T) {
+	require := require.New(t)
+
+	raw, zblock := newTestZcashHeader(1, [32]byte{})
+	require.NoError(verifyZcashHeader(raw, zblock, testEquihashN, testEquihashK))
+
+	// The attested fields must match the header
+	tampered := *zblock
+	tampered.MerkleRoot = hashToHex([32]byte{1})
+	require.ErrorIs(verifyZcashHeader(raw, &tampered, testEquihashN, testEquihashK), errHeaderMismatch)
+
+	// including the commitments, which hold the final Sapling root below
+	// Heartwood
+	tampered = *zblock
+	tampered.BlockCommitments = hashToHex([32]byte{1})
+	require.ErrorIs(verifyZcashHeader(raw, &tampered, testEquihashN, testEquihashK), errHeaderMismatch)
+	tampered = *zblock
+	tampered.FinalSaplingRoot = hashToHex([32]byte{1})
+	require.ErrorIs(verifyZcashHeader(raw, &tampered, testEquihashN, testEquihashK), errHeaderMismatch)
+
+	// From Heartwood the field holds the chain history root or the block
+	// commitments hash, not the final Sapling root
+	header, err := parseZcashHeader(raw)
+	require.NoError(err)
+	tampered.Height = heartwoodHeight
+	require.NoError(header.Matches(&tampered))
+
+	// A header with a modified nonce no longer hashes to the attested hash
+	modified := bytes.Clone(raw)
+	modified[108] ^= 1
+	require.ErrorIs(verifyZcashHeader(modified, zblock, testEquihashN, testEquihashK), errHeaderMismatch)
+
+	// The solution is checked against the network's parameters
+	require.ErrorIs(verifyZcashHeader(raw, zblock, 200, 9), errInvalidSolutionSize)
+
+	// A target of 1 can't be reached
+	header.Bits = 0x03000001
+	require.ErrorIs(header.VerifyWork(testEquihashN, testEquihashK), errInsufficientWork)
+
+	_, err = parseZcashHeader(raw[:len(raw)-1])
+	require.ErrorIs(err, errInvalidZcashHeader)
+}
+
+// require that real Zcash headers pass the (200, 9) verification, and that a
+// header with a bad solution or target doesn't
+func TestVerifyZcashHeaderKnownAnswer(t *testing.T) {
+	require := require.New(t)
+
+	tests := []struct {
+		name   string
+		header string
+		zblock *ZcashBlock
+	}{
+		{
+			name:   "mainnet genesis",
+			header: zcashMainnetGenesisHeader,
+			zblock: &ZcashBlock{
+				Hash:             "00040fe8ec8471911baa1db1266ea15dd06b4a8a5c453883c000b031973dce08",
+				Height:           0,
+				Version:          4,
+				MerkleRoot:       "c4eaa58879081de3c24a7b117ed2b28300e7ec4c4c1dff1d3f1268b7857a4ddb",
+				BlockCommitments: hashToHex([32]byte{}),
+				FinalSaplingRoot: hashToHex([32]byte{}),
+				Time:             1477641360,
+				Nonce:            "0000000000000000000000000000000000000000000000000000000000001257",
+				Bits:             "1f07ffff",
+			},
+		},
+		{
+			name:   "testnet sapling",
+			header: zcashTestnetHeader380640,
+			zblock: &ZcashBlock{
+				Hash:              "000a5e44b3b238d0cc36de7c0cb1ae5ac6e16f8727173abd295a83ebfa073b91",
+				Height:            380640,
+				Version:           4,
+				PreviousBlockHash: "00196a624a7c3c5ee497bc6c87dcd6dd53ccd6a56b50b4681e381f4824567806",
+				MerkleRoot:        "20a2b12ff0973c854aa37fbb302afb238c42b8e3c230ba0e902e2b11a90a458c",
+				BlockCommitments:  "5aabf39d635f3f44206c69192da101dd24db98061b138bfb92dcf23d94a7860d",
+				FinalSaplingRoot:  "5aabf39d635f3f44206c69192da101dd24db98061b138bfb92dcf23d94a7860d",
+				Time:              1546247404,
+				Nonce:             "0000ad42eda72a2c437ccb9a3c5c04c621e0f12ef1770a9f8c5f970c79000087",
+				Bits:              "1f192c17",
+			},
+		},
+	}
+	for _, test := range tests {
+		raw, err := hex.DecodeString(test.header)
+		require.NoError(err, test.name)
+		header, err := parseZcashHeader(raw)
+		require.NoError(err, test.name)
+		require.Len(header.Solution, 1344, test.name)
+		test.zblock.Solution = hex.EncodeToString(header.Solution)
+		require.NoError(verifyZcashHeader(raw, test.zblock, EquihashN, EquihashK), test.name)
+
+		// A flipped bit in the solution breaks the collisions
+		solution := bytes.Clone(header.Solution)
+		solution[len(solution)-1] ^= 1
+		require.ErrorIs(verifyEquihash(EquihashN, EquihashK, raw[:zcashHeaderPrefixLen], solution), errInvalidEquihashSolution, test.name)
+
+		// The hash is above a harder target than the one the block was mined
+		// at
+		header.Bits = 0x1d00ffff
+		require.ErrorIs(header.VerifyWork(EquihashN, EquihashK), errInsufficientWork, test.name)
+	}
+}
+
+// newTestZcashHeader mines a header at [height] on top of [prev] with the
+// test Equihash parameters, and returns it with the matching ZcashBlock
+func newTestZcashHeader(height uint64, prev [32]byte) ([]byte, *ZcashBlock) {
+	bitLen := testEquihashN/(testEquihashK+1) + 1
+	txIDs := testZcashTxIDs(height)
+	_, root, err := MerkleBranch(txIDs, 0)
+	if err != nil {
+		panic(err)
+	}
+	merkleRoot, err := hexToHash(root)
+	if err != nil {
+		panic(err)
+	}
+
+	// below Heartwood, the commitments field is the final Sapling root
+	saplingRoot := sha256.Sum256(binary.LittleEndian.AppendUint64(nil, height))
+
+	prefix := make([]byte, zcashHeaderPrefixLen)
+	binary.LittleEndian.PutUint32(prefix[0:], 4)
+	copy(prefix[4:], prev[:])
+	copy(prefix[36:], merkleRoot[:])
+	copy(prefix[68:], saplingRoot[:])
+	binary.LittleEndian.PutUint32(prefix[100:], uint32(1477641360+75*height))
+	binary.LittleEndian.PutUint32(prefix[104:], testZcashBits)
+	for nonce := uint64(0); ; nonce++ {
+		binary.LittleEndian.PutUint64(prefix[108:], nonce)
+		for _, solution := range solveEquihash(testEquihashN, testEquihashK, prefix) {
+			packed := packIndices(solution, bitLen)
+			raw := append(bytes.Clone(prefix), byte(len(packed)))
+			raw = append(raw, packed...)
+
+			header, err := parseZcashHeader(raw)
+			if err != nil {
+				panic(err)
+			}
+			if header.VerifyWork(testEquihashN, testEquihashK) != nil {
+				continue
+			}
+
+			zblock := &ZcashBlock{
+				Hash:             hashToHex(header.Hash()),
+				Height:           int(height),
+				Version:          int(header.Version),
+				MerkleRoot:       hashToHex(header.MerkleRoot),
+				BlockCommitments: hashToHex(saplingRoot),
+				FinalSaplingRoot: hashToHex(saplingRoot),
+				Time:             int(header.Time),
+				Nonce:            hashToHex(header.Nonce),
+				Solution:         hex.EncodeToString(header.Solution),
+				Bits:             "207fffff",
+				Tx:               txIDs,
+			}
+			if prev != [32]byte{} {
+				zblock.PreviousBlockHash = hashToHex(prev)
+			}
+			return raw, zblock
+		}
+	}
+}
+
+// solveEquihash finds the Equihash([n], [k]) solutions of [input] with
+// Wagner's algorithm. It is only fast enough for small parameters.
+func solveEquihash(n int, k int, input []byte) [][]uint32 {
+	type row struct {
+		hash    []byte
+		indices []uint32
+	}
+	var (
+		collisionBits  = n / (k + 1)
+		hashLen        = n / 8
+		indicesPerHash = 512 / n
+		numRows        = 1 << (collisionBits + 1)
+		person         = equihashPersonalization(n, k)
+	)
+
+	rows := make([]row, 0, numRows)
+	for i := 0; i < numRows; i += indicesPerHash {
+		msg := binary.LittleEndian.AppendUint32(bytes.Clone(input), uint32(i/indicesPerHash))
+		digest := blake2bPersonal(indicesPerHash*hashLen, person, msg)
+		for j := 0; j < indicesPerHash && i+j < numRows; j++ {
+			rows = append(rows, row{
+				hash:    digest[j*hashLen : (j+1)*hashLen],
+				indices: []uint32{uint32(i + j)},
+			})
+		}
+	}
+
+	bitsValue := func(b []byte, from, to int) uint64 {
+		var v uint64
+		for bit := from; bit < to; bit++ {
+			v = v<<1 | uint64(b[bit/8]>>(7-bit%8)&1)
+		}
+		return v
+	}
+	for round := 1; round <= k; round++ {
+		from, to := (round-1)*collisionBits, round*collisionBits
+		if round == k {
+			// the last round collides on the two remaining chunks
+			to = n
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			return bitsValue(rows[i].hash, from, to) < bitsValue(rows[j].hash, from, to)
+		})
+
+		var next []row
+		for i := 0; i < len(rows); {
+			j := i + 1
+			for j < len(rows) && bitsValue(rows[i].hash, from, to) == bitsValue(rows[j].hash, from, to) {
+				j++
+			}
+			for a := i; a < j; a++ {
+				for b := a + 1; b < j; b++ {
+					left, right := rows[a], rows[b]
+					if !distinctIndices(left.indices, right.indices) {
+						continue
+					}
+					if left.indices[0] > right.indices[0] {
+						left, right = right, left
+					}
+					hash := make([]byte, hashLen)
+					for x := range hash {
+						hash[x] = left.hash[x] ^ right.hash[x]
+					}
+					next = append(next, row{
+						hash:    hash,
+						indices: append(append([]uint32{}, left.indices...), right.indices...),
+					})
+				}
+			}
+			i = j
+		}
+		rows = next
+	}
+
+	solutions := make([][]uint32, len(rows))
+	for i, r := range rows {
+		solutions[i] = r.indices
+	}
+	return solutions
+}
+
+// packIndices is the inverse of unpackIndices
+func packIndices(indices []uint32, bitLen int) []byte {
+	packed := make([]byte, len(indices)*bitLen/8)
+	for i, index := range indices {
+		for b := 0; b < bitLen; b++ {
+			if index>>(bitLen-1-b)&1 != 0 {
+				bit := i*bitLen + b
+				packed[bit/8] |= 1 << (7 - bit%8)
+			}
+		}
+	}
+	return packed
+}
+
+// testZcashTxIDs returns the IDs of the transactions of the test Zcash block
+// at [height], one to four of them so that both odd and even Merkle tree
+// levels are covered
+func testZcashTxIDs(height uint64) []string {
+	txIDs := make([]string, height%4+1)
+	for i := range txIDs {
+		hash := sha256.Sum256(binary.BigEndian.AppendUint64([]byte{byte(i)}, height))
+		txIDs[i] = hashToHex(hash)
+	}
+	return txIDs
+}
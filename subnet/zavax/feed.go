@@ -0,0 +1,243 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	// FeedEndpoint is the path of the WebSocket feed of accepted blocks,
+	// relative to the chain's API
+	FeedEndpoint = "/ws"
+	// MaxFeedSubscribers bounds the number of open feed connections
+	MaxFeedSubscribers = 1024
+
+	// feedBufferSize is the number of accepted blocks queued for a
+	// subscriber before it's disconnected as too slow
+	feedBufferSize   = 256
+	feedWriteTimeout = 10 * time.Second
+	feedPingInterval = 30 * time.Second
+)
+
+var (
+	errInvalidFeedRange   = errors.New("invalid zcash height range")
+	errTooManySubscribers = errors.New("too many feed subscribers")
+)
+
+// feedSubscriber receives the accepted blocks attesting a Zcash height within
+// [from, to]. A zero bound is unbounded, and a subscriber without bounds also
+// receives the blocks that attest nothing.
+type feedSubscriber struct {
+	from, to uint64
+	replies  chan *GetBlockReply
+	// closed when the subscriber is disconnected
+	done chan struct{}
+	// reason the subscriber was disconnected by the feed
+	reason string
+}
+
+// match returns the first of [heights] within the range of [s]
+func (s *feedSubscriber) match(heights []uint64) (uint64, bool) {
+	if s.from == 0 && s.to == 0 {
+		return 0, true
+	}
+	for _, height := range heights {
+		if height >= s.from && (s.to == 0 || height <= s.to) {
+			return height, true
+		}
+	}
+	return 0, false
+}
+
+// blockFeed pushes the accepted blocks to its subscribers. Publishing never
+// blocks: a subscriber that falls feedBufferSize blocks behind is
+// disconnected.
+type blockFeed struct {
+	lock        sync.Mutex
+	subscribers map[*feedSubscriber]struct{}
+	closed      bool
+	upgrader    websocket.Upgrader
+}
+
+func newBlockFeed() *blockFeed {
+	return &blockFeed{
+		subscribers: make(map[*feedSubscriber]struct{}),
+		upgrader: websocket.Upgrader{
+			// The feed is read-only and serves public data
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+}
+
+// subscribe registers a subscriber to the blocks attesting [from, to]
+func (f *blockFeed) subscribe(from, to uint64) (*feedSubscriber, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed || len(f.subscribers) >= MaxFeedSubscribers {
+		return nil, errTooManySubscribers
+	}
+	s := &feedSubscriber{
+		from:    from,
+		to:      to,
+		replies: make(chan *GetBlockReply, feedBufferSize),
+		done:    make(chan struct{}),
+	}
+	f.subscribers[s] = struct{}{}
+	return s, nil
+}
+
+// unsubscribe disconnects [s] because of [reason], if it's still subscribed
+func (f *blockFeed) unsubscribe(s *feedSubscriber, reason string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.remove(s, reason)
+}
+
+func (f *blockFeed) remove(s *feedSubscriber, reason string) {
+	if _, ok := f.subscribers[s]; !ok {
+		return
+	}
+	delete(f.subscribers, s)
+	s.reason = reason
+	close(s.done)
+}
+
+// publish sends the accepted block [blk] attesting [zblocks] to the matching
+// subscribers
+func (f *blockFeed) publish(blk *Block, zblocks []*ZcashBlock) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(f.subscribers) == 0 {
+		return
+	}
+	heights := make([]uint64, len(zblocks))
+	for i, zblock := range zblocks {
+		heights[i] = uint64(zblock.Height)
+	}
+	reply := GetBlockReply{}
+	assignValues(&reply, blk)
+
+	for s := range f.subscribers {
+		height, ok := s.match(heights)
+		if !ok {
+			continue
+		}
+		subscriberReply := reply
+		if height != 0 {
+			// Like getBlockByHeight, Data is the attestation the
+			// subscriber asked for
+			for _, zblock := range reply.Attestations {
+				if uint64(zblock.Height) == height {
+					subscriberReply.Data = zblock
+				}
+			}
+		}
+		select {
+		case s.replies <- &subscriberReply:
+		default:
+			log.Warn("Disconnecting slow feed subscriber", "buffered", feedBufferSize)
+			f.remove(s, "subscriber too slow")
+		}
+	}
+}
+
+// close disconnects every subscriber and refuses new ones
+func (f *blockFeed) close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.closed = true
+	for s := range f.subscribers {
+		f.remove(s, "shutting down")
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection streaming a
+// GetBlockReply for every accepted block within the Zcash height range given
+// by the optional "from" and "to" query parameters
+func (f *blockFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseFeedRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := f.subscribe(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied with an error
+		f.unsubscribe(s, "upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	// Read the connection to process control frames and detect when the
+	// client goes away. Subscribers don't send anything else.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				f.unsubscribe(s, "connection closed")
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(feedPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case reply := <-s.replies:
+			conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+			if err := conn.WriteJSON(reply); err != nil {
+				f.unsubscribe(s, "write failed")
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(feedWriteTimeout)); err != nil {
+				f.unsubscribe(s, "ping failed")
+				return
+			}
+		case <-s.done:
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, s.reason)
+			conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(feedWriteTimeout))
+			return
+		}
+	}
+}
+
+// parseFeedRange reads the Zcash height range of a feed subscription
+func parseFeedRange(r *http.Request) (uint64, uint64, error) {
+	var bounds [2]uint64
+	for i, name := range []string{"from", "to"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		bound, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %s=%q", errInvalidFeedRange, name, value)
+		}
+		bounds[i] = bound
+	}
+	if bounds[1] != 0 && bounds[0] > bounds[1] {
+		return 0, 0, fmt.Errorf("%w: from %d is above to %d", errInvalidFeedRange, bounds[0], bounds[1])
+	}
+	return bounds[0], bounds[1], nil
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockFeed(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	server := httptest.NewServer(handlers[FeedEndpoint])
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, nil)
+		require.NoError(err)
+		return conn
+	}
+	all := dial("")
+	defer all.Close()
+	ranged := dial("?from=31&to=32")
+	defer ranged.Close()
+	require.Eventually(func() bool {
+		vm.feed.lock.Lock()
+		defer vm.feed.lock.Unlock()
+		return len(vm.feed.subscribers) == 2
+	}, 5*time.Second, time.Millisecond)
+
+	snowCtx.Lock.Lock()
+	var accepted []*Block
+	for _, height := range []uint64{30, 31, 33, 32} {
+		accepted = append(accepted, acceptZcashBlock(t, vm, height))
+	}
+	snowCtx.Lock.Unlock()
+
+	// Every accepted block is pushed in order
+	for _, blk := range accepted {
+		reply := GetBlockReply{}
+		require.NoError(all.ReadJSON(&reply))
+		require.Equal(blk.ID(), reply.ID)
+	}
+
+	// Only the blocks attesting a height within the range are pushed
+	for _, expected := range []int{31, 32} {
+		reply := GetBlockReply{}
+		require.NoError(ranged.ReadJSON(&reply))
+		require.Equal(expected, reply.Data.Height)
+	}
+
+	resp, err := http.Get(server.URL + "?from=2&to=1")
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// Shutting down disconnects the subscribers
+	snowCtx.Lock.Lock()
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+	_, _, err = all.ReadMessage()
+	require.True(websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+// require that a subscriber that doesn't keep up is dropped instead of
+// blocking acceptance
+func TestBlockFeedSlowSubscriber(t *testing.T) {
+	require := require.New(t)
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	genesis, err := vm.getBlock(vm.preferred)
+	require.NoError(err)
+
+	feed := newBlockFeed()
+	slow, err := feed.subscribe(0, 0)
+	require.NoError(err)
+	ranged, err := feed.subscribe(40, 0)
+	require.NoError(err)
+	for i := 0; i <= feedBufferSize; i++ {
+		feed.publish(genesis, nil)
+	}
+
+	<-slow.done
+	require.Equal("subscriber too slow", slow.reason)
+	require.Len(feed.subscribers, 1)
+	require.Empty(ranged.replies)
+
+	feed.close()
+	<-ranged.done
+	_, err = feed.subscribe(0, 0)
+	require.ErrorIs(err, errTooManySubscribers)
+}
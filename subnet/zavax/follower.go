@@ -0,0 +1,135 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	ejson "encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// followerStartHeight returns the first Zcash height the follower considers,
+// by default the first height above BlockConfirmHeight. The follower skips
+// the attested heights, so it also fills the gaps below the highest one.
+func (vm *VM) followerStartHeight() uint64 {
+	if vm.config.FollowStartHeight > 0 {
+		return vm.config.FollowStartHeight
+	}
+	return uint64(vm.config.BlockConfirmHeight) + 1
+}
+
+// followZcashTip polls the Zcash tip every FollowInterval and adds every
+// Zcash block from [next] on that has BlockConfirmHeight confirmations to the
+// mempool, until the VM shuts down
+func (vm *VM) followZcashTip(next uint64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-vm.shutdownChan
+		cancel()
+	}()
+
+	log.Info("Following zcash tip", "start", next)
+	ticker := time.NewTicker(vm.config.FollowInterval.Duration)
+	defer ticker.Stop()
+	for {
+		next = vm.followZcashTipOnce(ctx, next)
+		select {
+		case <-ctx.Done():
+			log.Info("Stopped following zcash tip", "next", next)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// followZcashTipOnce enqueues the final Zcash blocks from [next] up to the
+// current tip and returns the next height to enqueue. It stops early when the
+// mempool is full or zcashd can't be reached, so that the remaining heights
+// are retried on the next poll.
+func (vm *VM) followZcashTipOnce(ctx context.Context, next uint64) uint64 {
+	tip, err := vm.zcash.GetBlockCount(ctx)
+	if err != nil {
+		log.Warn("Failed to fetch zcash tip", "err", err)
+		return next
+	}
+
+	confirmations := uint64(vm.config.BlockConfirmHeight)
+	for ; next+confirmations <= tip; next++ {
+		attested, ok := vm.isZcashHeightAttested(next)
+		if !ok {
+			return next
+		}
+		if attested {
+			continue
+		}
+
+		zblock, err := vm.queryZcashBlock(ctx, next, false)
+		if err != nil {
+			log.Warn("Failed to fetch zcash block", "height", next, "err", err)
+			return next
+		}
+		data, err := ejson.Marshal(zblock)
+		if err != nil {
+			log.Error("Failed to encode zcash block", "height", next, "err", err)
+			return next
+		}
+		if !vm.enqueueZcashBlock(data) {
+			return next
+		}
+	}
+	return next
+}
+
+// isZcashHeightAttested returns whether [height] was already attested. ok is
+// false if the VM is shutting down, the mempool is full or the index can't be
+// read.
+func (vm *VM) isZcashHeightAttested(height uint64) (attested bool, ok bool) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() || vm.mempool.Full() {
+		return false, false
+	}
+	blk, err := vm.getBlockByHeight(height)
+	if err != nil {
+		log.Error("Failed to read zcash index", "height", height, "err", err)
+		return false, false
+	}
+	return blk != nil, true
+}
+
+// enqueueZcashBlock adds [data] to the mempool unless the VM is shutting down.
+// It returns false if the block should be retried on the next poll.
+func (vm *VM) enqueueZcashBlock(data []byte) bool {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() {
+		return false
+	}
+	err := vm.addZcashBlock(data)
+	switch {
+	case errors.Is(err, errBrokenHeaderChain):
+		// Leave the height to the reorg watcher rather than stalling on it
+		log.Warn("Skipping zcash block that breaks the header chain", "err", err)
+	case err != nil:
+		log.Warn("Failed to add zcash block to the mempool", "err", err)
+		return false
+	}
+	return true
+}
+
+// isShuttingDown returns true once Shutdown was called
+func (vm *VM) isShuttingDown() bool {
+	select {
+	case <-vm.shutdownChan:
+		return true
+	default:
+		return false
+	}
+}
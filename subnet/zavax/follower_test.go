@@ -0,0 +1,70 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/avalanchego/snow"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowZcashTip(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	// Heights up to testZcashTip-24 are final
+	vm, snowCtx, _, err := newTestVMWithConfig(t, map[string]interface{}{
+		"followZcashTip":    true,
+		"followInterval":    "10ms",
+		"followStartHeight": testZcashTip - 27,
+	})
+	require.NoError(err)
+
+	acceptZcashBlock(t, vm, testZcashTip-26)
+
+	mempoolLen := func() int {
+		snowCtx.Lock.Lock()
+		defer snowCtx.Lock.Unlock()
+		return vm.mempool.Len()
+	}
+
+	// Nothing is attested while bootstrapping
+	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
+	time.Sleep(50 * time.Millisecond)
+	require.Zero(mempoolLen())
+
+	snowCtx.Lock.Lock()
+	require.NoError(vm.SetState(ctx, snow.NormalOp))
+	snowCtx.Lock.Unlock()
+	require.Eventually(func() bool {
+		return mempoolLen() == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The attested height is skipped
+	snowCtx.Lock.Lock()
+	require.Equal([]uint64{testZcashTip - 27, testZcashTip - 25, testZcashTip - 24}, vm.mempool.queue)
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
+
+func TestFollowerStartHeight(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	// The gaps below the highest attested height are filled by default
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	acceptZcashBlock(t, vm, 30)
+	require.Equal(uint64(vm.config.BlockConfirmHeight)+1, vm.followerStartHeight())
+
+	vm.config.FollowStartHeight = 28
+	require.Equal(uint64(28), vm.followerStartHeight())
+
+	snowCtx.Lock.Lock()
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
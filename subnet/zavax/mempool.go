@@ -0,0 +1,241 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	errMempoolFull = errors.New("mempool full, please try again later")
+
+	_ MempoolState = &mempoolState{}
+)
+
+// MempoolState persists the Zcash blocks waiting to be attested, keyed by
+// Zcash height
+type MempoolState interface {
+	GetMempoolEntries() (map[uint64][]byte, error)
+	PutMempoolEntry(height uint64, data []byte) error
+	DeleteMempoolEntry(height uint64) error
+}
+
+type mempoolState struct {
+	// Zcash height --> JSON encoded Zcash block
+	mempoolDB database.Database
+}
+
+// NewMempoolState returns MempoolState with the given db
+func NewMempoolState(db database.Database) MempoolState {
+	return &mempoolState{
+		mempoolDB: db,
+	}
+}
+
+// GetMempoolEntries returns every persisted entry
+func (s *mempoolState) GetMempoolEntries() (map[uint64][]byte, error) {
+	it := s.mempoolDB.NewIterator()
+	defer it.Release()
+
+	entries := make(map[uint64][]byte)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != 8 {
+			return nil, fmt.Errorf("invalid mempool key %x", key)
+		}
+		entries[binary.BigEndian.Uint64(key)] = it.Value()
+	}
+	return entries, it.Error()
+}
+
+func (s *mempoolState) PutMempoolEntry(height uint64, data []byte) error {
+	return s.mempoolDB.Put(heightKey(height), data)
+}
+
+func (s *mempoolState) DeleteMempoolEntry(height uint64) error {
+	return s.mempoolDB.Delete(heightKey(height))
+}
+
+// mempool holds the Zcash blocks waiting to be attested, at most one per
+// Zcash height. An entry stays in the mempool until a block attesting its
+// height is accepted: building it into a block only takes it off the queue
+// until that block is rejected.
+type mempool struct {
+	state   State
+	maxSize int
+
+	// Zcash height --> JSON encoded Zcash block, for every entry
+	entries map[uint64][]byte
+	// heights of the entries that aren't part of a processing block, in the
+	// order they are built into blocks
+	queue []uint64
+	// block ID --> heights of the entries built into that block
+	building map[ids.ID][]uint64
+
+	// set to the number of entries
+	sizeGauge prometheus.Gauge
+}
+
+// newMempool returns the mempool persisted in [state], reporting its size to
+// [sizeGauge]
+func newMempool(state State, maxSize int, sizeGauge prometheus.Gauge) (*mempool, error) {
+	entries, err := state.GetMempoolEntries()
+	if err != nil {
+		return nil, err
+	}
+	m := &mempool{
+		state:     state,
+		maxSize:   maxSize,
+		entries:   entries,
+		queue:     make([]uint64, 0, len(entries)),
+		building:  make(map[ids.ID][]uint64),
+		sizeGauge: sizeGauge,
+	}
+	sizeGauge.Set(float64(len(entries)))
+	for height := range entries {
+		m.queue = append(m.queue, height)
+	}
+	sort.Slice(m.queue, func(i, j int) bool { return m.queue[i] < m.queue[j] })
+	return m, nil
+}
+
+// Len returns the number of entries waiting to be built into a block
+func (m *mempool) Len() int { return len(m.queue) }
+
+// Size returns the number of entries, including the ones built into a
+// processing block
+func (m *mempool) Size() int { return len(m.entries) }
+
+// Full returns true if no entry can be added
+func (m *mempool) Full() bool { return len(m.entries) >= m.maxSize }
+
+// Has returns true if the Zcash block at [height] is in the mempool
+func (m *mempool) Has(height uint64) bool {
+	_, ok := m.entries[height]
+	return ok
+}
+
+// Add persists [data], the Zcash block at [height]. Adding a height that is
+// already in the mempool is a no-op.
+func (m *mempool) Add(height uint64, data []byte) error {
+	if m.Has(height) {
+		return nil
+	}
+	if m.Full() {
+		return errMempoolFull
+	}
+	if err := m.state.PutMempoolEntry(height, data); err != nil {
+		return err
+	}
+	if err := m.state.Commit(); err != nil {
+		return err
+	}
+	m.entries[height] = data
+	m.queue = append(m.queue, height)
+	m.sizeGauge.Set(float64(len(m.entries)))
+	return nil
+}
+
+// Peek returns the next entry to build into a block. It must not be called
+// on an empty queue.
+func (m *mempool) Peek() (uint64, []byte) {
+	height := m.queue[0]
+	return height, m.entries[height]
+}
+
+// Pop takes the next entry off the queue
+func (m *mempool) Pop() {
+	m.queue = m.queue[1:]
+}
+
+// Built records that the popped entries at [heights] were built into the
+// block [blkID]
+func (m *mempool) Built(blkID ids.ID, heights []uint64) {
+	m.building[blkID] = heights
+}
+
+// Requeue puts the entries at [heights] back at the front of the queue
+func (m *mempool) Requeue(heights []uint64) {
+	var requeued []uint64
+	for _, height := range heights {
+		if m.Has(height) {
+			requeued = append(requeued, height)
+		}
+	}
+	m.queue = append(requeued, m.queue...)
+}
+
+// Rejected puts the entries built into the rejected block [blkID] back in
+// the queue, and returns their heights
+func (m *mempool) Rejected(blkID ids.ID) []uint64 {
+	heights, ok := m.building[blkID]
+	if !ok {
+		return nil
+	}
+	delete(m.building, blkID)
+	m.Requeue(heights)
+	return heights
+}
+
+// Abandoned puts the entries built into a block that [processing] returns
+// false for, which the engine dropped without verifying it, back in the
+// queue, and returns their heights
+func (m *mempool) Abandoned(processing func(ids.ID) bool) []uint64 {
+	var heights []uint64
+	for blkID, built := range m.building {
+		if processing(blkID) {
+			continue
+		}
+		delete(m.building, blkID)
+		heights = append(heights, built...)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	m.Requeue(heights)
+	return heights
+}
+
+// Dropped removes the entries built into the block [blkID], whose attestations
+// don't match the Zcash chain, and returns their heights
+func (m *mempool) Dropped(blkID ids.ID) ([]uint64, error) {
+	heights, ok := m.building[blkID]
+	if !ok {
+		return nil, nil
+	}
+	delete(m.building, blkID)
+	for _, height := range heights {
+		if err := m.Remove(height); err != nil {
+			return nil, err
+		}
+	}
+	return heights, m.state.Commit()
+}
+
+// Accepted forgets the block [blkID] whose entries were removed by Remove
+func (m *mempool) Accepted(blkID ids.ID) {
+	delete(m.building, blkID)
+}
+
+// Remove deletes the entry at [height], if any. The deletion is persisted on
+// the next commit of the state.
+func (m *mempool) Remove(height uint64) error {
+	if !m.Has(height) {
+		return nil
+	}
+	delete(m.entries, height)
+	m.sizeGauge.Set(float64(len(m.entries)))
+	for i, queued := range m.queue {
+		if queued == height {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	return m.state.DeleteMempoolEntry(height)
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/snow/engine/common"
+	"github.com/ava-labs/avalanchego/snow/snowtest"
+	"github.com/stretchr/testify/require"
+)
+
+// require that pending Zcash blocks survive a restart and leave the mempool
+// once attested
+func TestMempoolPersistence(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	for height := uint64(1); height <= 3; height++ {
+		proposeZcashBlock(t, vm, height)
+	}
+	// Adding a pending height again is a no-op
+	proposeZcashBlock(t, vm, 2)
+	require.Equal(3, vm.mempool.Len())
+
+	snowCtx.Lock.Lock()
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+
+	restarted := &VM{zcash: vm.zcash, equihashN: vm.equihashN, equihashK: vm.equihashK}
+	config, err := json.Marshal(vm.config)
+	require.NoError(err)
+	require.NoError(restarted.Initialize(ctx, snowtest.Context(t, blockchainID), vm.dbManager, []byte{0, 0, 0, 0, 0}, nil, config, make(chan common.Message, 1), nil, nil))
+	require.Equal([]uint64{1, 2, 3}, restarted.mempool.queue)
+
+	// A rejected block returns its Zcash blocks to the queue
+	blk, err := restarted.BuildBlock(ctx)
+	require.NoError(err)
+	require.Zero(restarted.mempool.Len())
+	require.Equal(3, restarted.mempool.Size())
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Reject(ctx))
+	require.Equal(3, restarted.mempool.Len())
+
+	// An accepted block removes them from the mempool and its database
+	blk, err = restarted.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Zero(restarted.mempool.Size())
+	entries, err := restarted.state.GetMempoolEntries()
+	require.NoError(err)
+	require.Empty(entries)
+}
+
+// require that an invalid block built by this node drops its Zcash blocks
+func TestMempoolDropsInvalid(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+
+	zblock, err := vm.queryZcashBlock(ctx, 1, true)
+	require.NoError(err)
+	zblock.Hash = "invalid"
+	data, err := json.Marshal(zblock)
+	require.NoError(err)
+	require.NoError(vm.addZcashBlock(data))
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.ErrorIs(blk.Verify(ctx), errBlockNotMatch)
+	require.Zero(vm.mempool.Size())
+}
+
+// require that a block this node can't verify, e.g. because its zcashd lags
+// behind, returns its Zcash blocks to the queue
+func TestMempoolRequeuesLocalFailures(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	proposeZcashBlock(t, vm, 40)
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	src := vm.zcash.(*testZcashSource)
+	tip := src.tip
+	src.tip = 40
+	require.ErrorIs(blk.Verify(ctx), errBlockHeightNotAllowed)
+	require.Equal(1, vm.mempool.Len())
+
+	// Once zcashd caught up, the Zcash block is attested
+	src.tip = tip
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Zero(vm.mempool.Size())
+}
+
+// require that the Zcash blocks of a block the engine dropped without
+// verifying it are built again
+func TestMempoolRequeuesAbandoned(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	proposeZcashBlock(t, vm, 40)
+
+	_, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.Zero(vm.mempool.Len())
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.Equal([]uint64{40}, blk.(*Block).zcashHeights())
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Zero(vm.mempool.Size())
+}
+
+// require that requests are refused once the mempool is full
+func TestMempoolFull(t *testing.T) {
+	require := require.New(t)
+
+	vm, _, _, err := newTestVMWithConfig(t, map[string]interface{}{"maxMempoolSize": 2})
+	require.NoError(err)
+	service := Service{vm: vm, tracker: vm.tracker}
+	request := httptest.NewRequest("POST", "/", nil)
+
+	for height := uint64(1); height <= 2; height++ {
+		require.NoError(service.GetBlockByHeight(request, &QueryDataArgs{ID: height}, &GetBlockReply{}))
+	}
+	require.ErrorIs(service.GetBlockByHeight(request, &QueryDataArgs{ID: 3}, &GetBlockReply{}), errMempoolFull)
+	require.Equal(2, vm.mempool.Size())
+}
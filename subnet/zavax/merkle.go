@@ -0,0 +1,110 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+var (
+	errInvalidTxID         = errors.New("invalid zcash transaction ID")
+	errInvalidMerkleBranch = errors.New("invalid merkle branch")
+	errTxNotInBlock        = errors.New("zcash block does not include this transaction")
+	errMerkleRootMismatch  = errors.New("zcash transactions do not hash to the attested merkle root")
+)
+
+// MerkleBranch returns the Merkle branch of the transaction at [index] of
+// [txIDs], from the leaf up, and the Merkle root of [txIDs]. Like in Bitcoin,
+// a level with an odd number of nodes pairs its last node with itself.
+func MerkleBranch(txIDs []string, index int) ([]string, string, error) {
+	if index < 0 || index >= len(txIDs) {
+		return nil, "", fmt.Errorf("%w: index %d of %d transactions", errInvalidMerkleBranch, index, len(txIDs))
+	}
+	level := make([][32]byte, len(txIDs))
+	for i, txID := range txIDs {
+		hash, err := hexToHash(txID)
+		if err != nil {
+			return nil, "", err
+		}
+		level[i] = hash
+	}
+
+	branch := []string{}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, hashToHex(level[index^1]))
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			next[i] = hashMerkleNode(level[2*i], level[2*i+1])
+		}
+		level = next
+		index /= 2
+	}
+	return branch, hashToHex(level[0]), nil
+}
+
+// ComputeMerkleRoot returns the Merkle root reached by hashing [txID] at
+// [index] up the Merkle branch [branch], in a block of [txCount]
+// transactions. The branch must have the depth of the tree, so that it can't
+// prove an inner node, and the last node of an odd level must be paired with
+// itself. Hashes are in their RPC (byte reversed) hex encoding.
+func ComputeMerkleRoot(txID string, index uint32, txCount uint32, branch []string) (string, error) {
+	if index >= txCount {
+		return "", fmt.Errorf("%w: index %d of %d transactions", errInvalidMerkleBranch, index, txCount)
+	}
+	if depth := merkleDepth(txCount); len(branch) != depth {
+		return "", fmt.Errorf("%w: %d hashes for %d transactions, expected %d", errInvalidMerkleBranch, len(branch), txCount, depth)
+	}
+	hash, err := hexToHash(txID)
+	if err != nil {
+		return "", err
+	}
+	width := txCount
+	for level, siblingHex := range branch {
+		sibling, err := hexToHash(siblingHex)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errInvalidMerkleBranch, err)
+		}
+		if index == width-1 && width%2 == 1 && sibling != hash {
+			return "", fmt.Errorf("%w: last node of level %d isn't paired with itself", errInvalidMerkleBranch, level)
+		}
+		if index%2 == 0 {
+			hash = hashMerkleNode(hash, sibling)
+		} else {
+			hash = hashMerkleNode(sibling, hash)
+		}
+		index /= 2
+		width = (width + 1) / 2
+	}
+	return hashToHex(hash), nil
+}
+
+// merkleDepth returns the depth of the Merkle tree of [txCount] transactions,
+// ceil(log2(txCount))
+func merkleDepth(txCount uint32) int {
+	return bits.Len32(txCount - 1)
+}
+
+// hashMerkleNode returns the double SHA-256 of [left] and [right]
+func hashMerkleNode(left [32]byte, right [32]byte) [32]byte {
+	first := sha256.Sum256(append(left[:], right[:]...))
+	return sha256.Sum256(first[:])
+}
+
+// hexToHash decodes the RPC encoding of a hash, the inverse of hashToHex
+func hexToHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != len(hash) {
+		return hash, fmt.Errorf("%w: %q", errInvalidTxID, s)
+	}
+	copy(hash[:], raw)
+	return reverseHash(hash), nil
+}
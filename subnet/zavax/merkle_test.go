@@ -0,0 +1,87 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleBranch(t *testing.T) {
+	require := require.New(t)
+
+	// Bitcoin block 100000, which Zcash inherited its Merkle tree from
+	txIDs := []string{
+		"8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87",
+		"fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4",
+		"6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4",
+		"e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d",
+	}
+	branch, root, err := MerkleBranch(txIDs, 2)
+	require.NoError(err)
+	require.Equal("f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766", root)
+	require.Len(branch, 2)
+	require.Equal(txIDs[3], branch[0])
+
+	// Every transaction of every tree shape hashes back to the root
+	for size := 1; size <= 7; size++ {
+		txIDs := testZcashTxIDs(uint64(size))[:1]
+		for len(txIDs) < size {
+			txIDs = append(txIDs, fmt.Sprintf("%064x", len(txIDs)))
+		}
+		for index, txID := range txIDs {
+			branch, root, err := MerkleBranch(txIDs, index)
+			require.NoError(err)
+			computed, err := ComputeMerkleRoot(txID, uint32(index), uint32(size), branch)
+			require.NoError(err)
+			require.Equal(root, computed, "size %d index %d", size, index)
+		}
+	}
+
+	_, _, err = MerkleBranch(txIDs, 4)
+	require.ErrorIs(err, errInvalidMerkleBranch)
+	_, _, err = MerkleBranch([]string{"00"}, 0)
+	require.ErrorIs(err, errInvalidTxID)
+
+	// A proof doesn't hold for another transaction or position
+	computed, err := ComputeMerkleRoot(txIDs[3], 2, 4, branch)
+	require.NoError(err)
+	require.NotEqual(root, computed)
+	computed, err = ComputeMerkleRoot(txIDs[2], 3, 4, branch)
+	require.NoError(err)
+	require.NotEqual(root, computed)
+
+	_, err = ComputeMerkleRoot(txIDs[2], 4, 4, branch)
+	require.ErrorIs(err, errInvalidMerkleBranch)
+	_, err = ComputeMerkleRoot(txIDs[2], 2, 4, []string{branch[0], strings.Repeat("z", 64)})
+	require.ErrorIs(err, errInvalidMerkleBranch)
+
+	// An inner node can't be proven with a shorter branch, unless the number
+	// of transactions is wrong too, which is why it must be trusted
+	inner := hashToHex(hashMerkleNode(mustHexToHash(t, txIDs[2]), mustHexToHash(t, txIDs[3])))
+	computed, err = ComputeMerkleRoot(inner, 1, 2, branch[1:])
+	require.NoError(err)
+	require.Equal(root, computed)
+	_, err = ComputeMerkleRoot(inner, 1, 4, branch[1:])
+	require.ErrorIs(err, errInvalidMerkleBranch)
+
+	// The last node of an odd level is paired with itself
+	txIDs = txIDs[:3]
+	branch, root, err = MerkleBranch(txIDs, 2)
+	require.NoError(err)
+	computed, err = ComputeMerkleRoot(txIDs[2], 2, 3, branch)
+	require.NoError(err)
+	require.Equal(root, computed)
+	_, err = ComputeMerkleRoot(txIDs[2], 2, 3, []string{txIDs[1], branch[1]})
+	require.ErrorIs(err, errInvalidMerkleBranch)
+}
+
+func mustHexToHash(t *testing.T, s string) [32]byte {
+	hash, err := hexToHash(s)
+	require.NoError(t, err)
+	return hash
+}
@@ -0,0 +1,225 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ava-labs/avalanchego/utils/wrappers"
+)
+
+// Labels of the dedupeHits metric, where a Zcash block that is already
+// attested or pending is skipped
+const (
+	dedupeAttested = "attested"
+	dedupeMempool  = "mempool"
+	dedupeBuild    = "build"
+)
+
+// verifyFailureReasons labels the verify failures by their cause. The first
+// entry matching the error wins, so the more specific errors come first.
+var verifyFailureReasons = []struct {
+	reason string
+	errs   []error
+}{
+	{"zcash_unavailable", []error{errZcashUnavailable, errZcashTransient, errBlockHeightNotFetch}},
+	{"zcash_not_final", []error{errBlockHeightNotAllowed, errBlockHeightNotFound}},
+	{"duplicate", []error{errBlockAlreadyReq}},
+	{"invalid_correction", []error{errInvalidCorrection}},
+	{"invalid_work", []error{errInvalidEquihashSolution, errInvalidSolutionSize, errInsufficientWork}},
+	{"header_mismatch", []error{errHeaderMismatch, errInvalidZcashHeader}},
+	{"invalid_payload", []error{errInvalidPayload}},
+	{"attestation_mismatch", []error{errHashMismatch, errHeaderFieldMismatch, errRootMismatch, errTxMismatch, errValuePoolMismatch, errMissingAttestation, errNoAttestations}},
+	{"zcash_mismatch", []error{errBlockNotMatch}},
+	{"batch_too_large", []error{errBatchTooLarge}},
+	{"timestamp", []error{errTimestampTooEarly, errTimestampTooLate}},
+}
+
+// verifyFailureReason returns the label of the verify failure [err]
+func verifyFailureReason(err error) string {
+	for _, entry := range verifyFailureReasons {
+		for _, target := range entry.errs {
+			if errors.Is(err, target) {
+				return entry.reason
+			}
+		}
+	}
+	return "other"
+}
+
+// metrics of the VM, registered on the snow context so they are served by
+// avalanchego's metrics API
+type metrics struct {
+	zcashEndpointDissents *prometheus.CounterVec
+
+	blocksBuilt    prometheus.Counter
+	blocksVerified prometheus.Counter
+	blocksAccepted prometheus.Counter
+	blocksRejected prometheus.Counter
+	verifyFailures *prometheus.CounterVec
+
+	zcashRequestDuration *prometheus.HistogramVec
+	zcashRequestErrors   *prometheus.CounterVec
+
+	mempoolSize         prometheus.Gauge
+	dedupeHits          *prometheus.CounterVec
+	blockCacheGets      *prometheus.CounterVec
+	reconcileMismatches prometheus.Counter
+}
+
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		zcashEndpointDissents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "zcash_endpoint_dissents",
+				Help: "Number of zcash endpoint responses that disagreed with the quorum or failed",
+			},
+			[]string{"endpoint", "method", "reason"},
+		),
+		blocksBuilt: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocks_built",
+			Help: "Number of blocks built by this node",
+		}),
+		blocksVerified: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocks_verified",
+			Help: "Number of blocks that passed verification",
+		}),
+		blocksAccepted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocks_accepted",
+			Help: "Number of accepted blocks",
+		}),
+		blocksRejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "blocks_rejected",
+			Help: "Number of rejected blocks",
+		}),
+		verifyFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "verify_failures",
+				Help: "Number of blocks that failed verification, by reason",
+			},
+			[]string{"reason"},
+		),
+		zcashRequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "zcash_request_duration_seconds",
+				Help:    "Duration of the zcash RPC requests, retries included",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint", "method"},
+		),
+		zcashRequestErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "zcash_request_errors",
+				Help: "Number of failed zcash RPC requests",
+			},
+			[]string{"endpoint", "method"},
+		),
+		mempoolSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mempool_size",
+			Help: "Number of zcash blocks waiting to be attested",
+		}),
+		dedupeHits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dedupe_hits",
+				Help: "Number of zcash blocks skipped because they were already attested or pending, by stage",
+			},
+			[]string{"stage"},
+		),
+		blockCacheGets: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "block_cache_gets",
+				Help: "Number of block lookups, by whether the block cache held them",
+			},
+			[]string{"result"},
+		),
+		reconcileMismatches: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "reconcile_mismatches",
+			Help: "Number of attested zcash blocks that reconciling found to differ from the zcash chain",
+		}),
+	}
+
+	errs := wrappers.Errs{}
+	errs.Add(
+		registerer.Register(m.zcashEndpointDissents),
+		registerer.Register(m.blocksBuilt),
+		registerer.Register(m.blocksVerified),
+		registerer.Register(m.blocksAccepted),
+		registerer.Register(m.blocksRejected),
+		registerer.Register(m.verifyFailures),
+		registerer.Register(m.zcashRequestDuration),
+		registerer.Register(m.zcashRequestErrors),
+		registerer.Register(m.mempoolSize),
+		registerer.Register(m.dedupeHits),
+		registerer.Register(m.blockCacheGets),
+		registerer.Register(m.reconcileMismatches),
+	)
+	return m, errs.Err
+}
+
+// meteredZcashSource records the latency and errors of the requests to a
+// single zcashd
+type meteredZcashSource struct {
+	ZcashSource
+	endpoint string
+	metrics  *metrics
+}
+
+func newMeteredZcashSource(src ZcashSource, endpoint string, metrics *metrics) ZcashSource {
+	if metrics == nil {
+		return src
+	}
+	return &meteredZcashSource{
+		ZcashSource: src,
+		endpoint:    endpoint,
+		metrics:     metrics,
+	}
+}
+
+// observe records a request for [method] that started at [start] and failed
+// with [err], if not nil
+func (s *meteredZcashSource) observe(method string, start time.Time, err error) {
+	s.metrics.zcashRequestDuration.WithLabelValues(s.endpoint, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.metrics.zcashRequestErrors.WithLabelValues(s.endpoint, method).Inc()
+	}
+}
+
+func (s *meteredZcashSource) GetBlockCount(ctx context.Context) (uint64, error) {
+	start := time.Now()
+	count, err := s.ZcashSource.GetBlockCount(ctx)
+	s.observe("getblockcount", start, err)
+	return count, err
+}
+
+func (s *meteredZcashSource) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	start := time.Now()
+	hash, err := s.ZcashSource.GetBlockHash(ctx, height)
+	s.observe("getblockhash", start, err)
+	return hash, err
+}
+
+func (s *meteredZcashSource) GetBlock(ctx context.Context, hash string) (*ZcashBlock, error) {
+	start := time.Now()
+	block, err := s.ZcashSource.GetBlock(ctx, hash)
+	s.observe("getblock", start, err)
+	return block, err
+}
+
+func (s *meteredZcashSource) GetBlockHeader(ctx context.Context, hash string) ([]byte, error) {
+	start := time.Now()
+	header, err := s.ZcashSource.GetBlockHeader(ctx, hash)
+	s.observe("getblockheader", start, err)
+	return header, err
+}
+
+func (s *meteredZcashSource) GetRawTransaction(ctx context.Context, txID string) (string, error) {
+	start := time.Now()
+	rawTx, err := s.ZcashSource.GetRawTransaction(ctx, txID)
+	s.observe("getrawtransaction", start, err)
+	return rawTx, err
+}
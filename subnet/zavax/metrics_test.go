@@ -0,0 +1,91 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	m := vm.metrics
+
+	blk := acceptZcashBlock(t, vm, 30)
+	require.Equal(1.0, testutil.ToFloat64(m.blocksBuilt))
+	require.Equal(1.0, testutil.ToFloat64(m.blocksVerified))
+	// The genesis block is accepted on initialization
+	require.Equal(2.0, testutil.ToFloat64(m.blocksAccepted))
+
+	// Requesting a Zcash block twice is deduplicated
+	proposeZcashBlock(t, vm, 31)
+	require.Equal(1.0, testutil.ToFloat64(m.mempoolSize))
+	proposeZcashBlock(t, vm, 31)
+	require.Equal(1.0, testutil.ToFloat64(m.dedupeHits.WithLabelValues(dedupeMempool)))
+	require.Equal(1.0, testutil.ToFloat64(m.mempoolSize))
+	zblock, err := vm.queryZcashBlock(ctx, 30, true)
+	require.NoError(err)
+	data, err := json.Marshal(zblock)
+	require.NoError(err)
+	require.ErrorIs(vm.addZcashBlock(data), errBlockAlreadyReq)
+	require.Equal(1.0, testutil.ToFloat64(m.dedupeHits.WithLabelValues(dedupeAttested)))
+
+	// A block attesting Zcash height 30 again fails verification
+	duplicate, err := vm.NewBlock(blk.ID(), blk.Height()+1, encodeTestPayload(t, zblock), time.Now())
+	require.NoError(err)
+	require.ErrorIs(duplicate.Verify(ctx), errBlockAlreadyReq)
+	require.Equal(1.0, testutil.ToFloat64(m.verifyFailures.WithLabelValues("duplicate")))
+
+	built, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(built.Verify(ctx))
+	require.NoError(built.Reject(ctx))
+	require.Equal(1.0, testutil.ToFloat64(m.blocksRejected))
+
+	_, err = vm.getBlock(blk.ID())
+	require.NoError(err)
+	require.Positive(testutil.ToFloat64(m.blockCacheGets.WithLabelValues("hit")))
+
+	// Reconciling finds the attestation of a reorged Zcash block
+	vm.zcash.(*testZcashSource).blocks[30].Hash = fmt.Sprintf("%064x", 30)
+	service := Service{vm: vm, tracker: vm.tracker}
+	report := GetReconcileReply{}
+	require.NoError(service.ReconcileBlocks(httptest.NewRequest("POST", "/", nil), nil, &report))
+	require.Len(report.Height, 1)
+	require.Equal(1.0, testutil.ToFloat64(m.reconcileMismatches))
+}
+
+func TestMeteredZcashSource(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	m, err := newMetrics(prometheus.NewRegistry())
+	require.NoError(err)
+	src := newMeteredZcashSource(newTestZcashSource(10), "node", m)
+
+	_, err = src.GetBlockCount(ctx)
+	require.NoError(err)
+	_, err = src.GetBlockHash(ctx, 11)
+	require.ErrorIs(err, errZcashEmptyResult)
+
+	require.Equal(1, testutil.CollectAndCount(m.zcashRequestDuration.WithLabelValues("node", "getblockcount").(prometheus.Histogram)))
+	require.Zero(testutil.ToFloat64(m.zcashRequestErrors.WithLabelValues("node", "getblockcount")))
+	require.Equal(1.0, testutil.ToFloat64(m.zcashRequestErrors.WithLabelValues("node", "getblockhash")))
+
+	require.Equal("header_mismatch", verifyFailureReason(fmt.Errorf("%w: %w", errBlockNotMatch, errHeaderMismatch)))
+	require.Equal("zcash_unavailable", verifyFailureReason(fmt.Errorf("%w: %w", errBlockNotMatch, errZcashUnavailable)))
+	require.Equal("other", verifyFailureReason(errDatabaseGet))
+}
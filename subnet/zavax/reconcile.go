@@ -0,0 +1,515 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/utils/hashing"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	// DefaultReconcileWorkers is the number of Zcash heights a reconcile job
+	// checks in parallel unless told otherwise
+	DefaultReconcileWorkers = 4
+	// MaxReconcileWorkers bounds the parallelism of a reconcile job
+	MaxReconcileWorkers = 32
+	// MaxReconcileJobs bounds the number of reconcile jobs running at once
+	MaxReconcileJobs = 4
+
+	// number of stopped reconcile jobs kept, the least recently updated
+	// ones are deleted first
+	maxStoppedReconcileJobs = 64
+
+	// number of Zcash heights checked between two checkpoints
+	reconcileBatchSize = 256
+	// delay before a batch that failed to reach zcashd is checked again, it
+	// doubles on every failure up to maxReconcileRetryBackoff
+	reconcileRetryBackoff    = 250 * time.Millisecond
+	maxReconcileRetryBackoff = time.Minute
+)
+
+// Statuses of a reconcile job
+const (
+	ReconcileRunning   = "running"
+	ReconcileCompleted = "completed"
+	ReconcileCancelled = "cancelled"
+	ReconcileFailed    = "failed"
+)
+
+var (
+	errUnknownReconcileJob = errors.New("unknown reconcile job")
+	errInvalidRange        = errors.New("invalid zcash height range")
+	errInvalidWorkers      = errors.New("invalid number of reconcile workers")
+	errJobNotRunning       = errors.New("reconcile job is not running")
+	errShuttingDown        = errors.New("vm is shutting down")
+	errJobNotCompleted     = errors.New("reconcile job did not complete")
+	errTooManyJobs         = errors.New("too many reconcile jobs running")
+
+	_ ReconcileState = &reconcileState{}
+)
+
+// ReconcileJob compares the attestations of a range of Zcash heights with
+// zcashd in the background. Its progress is persisted after every batch of
+// heights, so that it resumes from its checkpoint after a restart.
+type ReconcileJob struct {
+	ID ids.ID `serialize:"true"`
+	// Start and End are the inclusive range of checked Zcash heights
+	Start   uint64 `serialize:"true"`
+	End     uint64 `serialize:"true"`
+	Workers uint32 `serialize:"true"`
+	Status  string `serialize:"true"`
+	// Checkpoint is the first Zcash height that wasn't checked yet
+	Checkpoint uint64 `serialize:"true"`
+	// Mismatched are the checked heights whose attested hash no longer
+	// matches zcashd, once per attestation, and Superseded the ones of them
+	// already corrected by a later block
+	Mismatched []uint64 `serialize:"true"`
+	Superseded []uint64 `serialize:"true"`
+	// Error is the reason a failed job stopped, or the last zcashd error a
+	// running job is waiting out
+	Error     string `serialize:"true"`
+	StartedAt int64  `serialize:"true"`
+	UpdatedAt int64  `serialize:"true"`
+}
+
+// ReconcileState persists the reconcile jobs, keyed by job ID
+type ReconcileState interface {
+	GetReconcileJobs() ([]*ReconcileJob, error)
+	GetReconcileJob(jobID ids.ID) (*ReconcileJob, error)
+	PutReconcileJob(job *ReconcileJob) error
+	DeleteReconcileJob(jobID ids.ID) error
+}
+
+type reconcileState struct {
+	// job ID --> ReconcileJob
+	reconcileDB database.Database
+}
+
+// NewReconcileState returns ReconcileState with the given db
+func NewReconcileState(db database.Database) ReconcileState {
+	return &reconcileState{
+		reconcileDB: db,
+	}
+}
+
+func (s *reconcileState) GetReconcileJobs() ([]*ReconcileJob, error) {
+	it := s.reconcileDB.NewIterator()
+	defer it.Release()
+
+	var jobs []*ReconcileJob
+	for it.Next() {
+		job := &ReconcileJob{}
+		if _, err := Codec.Unmarshal(it.Value(), job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, it.Error()
+}
+
+// GetReconcileJob returns errUnknownReconcileJob if there is no job [jobID]
+func (s *reconcileState) GetReconcileJob(jobID ids.ID) (*ReconcileJob, error) {
+	bytes, err := s.reconcileDB.Get(jobID[:])
+	if err == database.ErrNotFound {
+		return nil, fmt.Errorf("%w: %s", errUnknownReconcileJob, jobID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	job := &ReconcileJob{}
+	if _, err := Codec.Unmarshal(bytes, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *reconcileState) PutReconcileJob(job *ReconcileJob) error {
+	bytes, err := Codec.Marshal(CodecVersion, job)
+	if err != nil {
+		return err
+	}
+	return s.reconcileDB.Put(job.ID[:], bytes)
+}
+
+func (s *reconcileState) DeleteReconcileJob(jobID ids.ID) error {
+	return s.reconcileDB.Delete(jobID[:])
+}
+
+// reconcileRun is a reconcile job running in the background
+type reconcileRun struct {
+	// start and end are the range of the job
+	start  uint64
+	end    uint64
+	cancel context.CancelFunc
+	// done is closed once the job stops
+	done chan struct{}
+}
+
+// reconcileEntry holds the attestations of a Zcash height
+type reconcileEntry struct {
+	height       uint64
+	attestations []reconcileAttestation
+}
+
+type reconcileAttestation struct {
+	hash string
+	// superseded is true if a later block corrects the attestation
+	superseded bool
+}
+
+// startReconcileJob persists and starts a job checking the Zcash heights
+// from [start] to [end]. A zero [start] defaults to the first height above
+// BlockConfirmHeight, a zero [end] to the highest attested height. If a job
+// over the same range is already running, it is returned instead.
+func (vm *VM) startReconcileJob(start uint64, end uint64, workers uint32) (*ReconcileJob, error) {
+	if workers == 0 {
+		workers = DefaultReconcileWorkers
+	}
+	if workers > MaxReconcileWorkers {
+		return nil, fmt.Errorf("%w: %d, max %d", errInvalidWorkers, workers, MaxReconcileWorkers)
+	}
+	if start == 0 {
+		start = uint64(vm.config.BlockConfirmHeight) + 1
+	}
+	highest, err := vm.state.GetHighestZcashHeight()
+	if err != nil {
+		return nil, err
+	}
+	if end == 0 || end > highest {
+		end = highest
+	}
+	if start > end {
+		return nil, fmt.Errorf("%w: %d to %d, highest attested height is %d", errInvalidRange, start, end, highest)
+	}
+	for jobID, run := range vm.reconcileJobs {
+		if run.start == start && run.end == end {
+			return vm.state.GetReconcileJob(jobID)
+		}
+	}
+	if len(vm.reconcileJobs) >= MaxReconcileJobs {
+		return nil, fmt.Errorf("%w: max %d", errTooManyJobs, MaxReconcileJobs)
+	}
+	if err := vm.pruneReconcileJobs(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	jobID := hashing.ComputeHash256Array(binary.BigEndian.AppendUint64(
+		binary.BigEndian.AppendUint64(heightKey(start), end),
+		uint64(now.UnixNano()),
+	))
+	job := &ReconcileJob{
+		ID:         jobID,
+		Start:      start,
+		End:        end,
+		Workers:    workers,
+		Status:     ReconcileRunning,
+		Checkpoint: start,
+		StartedAt:  now.Unix(),
+		UpdatedAt:  now.Unix(),
+	}
+	if err := vm.state.PutReconcileJob(job); err != nil {
+		return nil, err
+	}
+	if err := vm.state.Commit(); err != nil {
+		return nil, err
+	}
+	// the job is updated in the background
+	running := *job
+	vm.runReconcileJob(&running)
+	return job, nil
+}
+
+// pruneReconcileJobs deletes the least recently updated stopped jobs, so that
+// a new one can be added without keeping more than maxStoppedReconcileJobs
+func (vm *VM) pruneReconcileJobs() error {
+	jobs, err := vm.state.GetReconcileJobs()
+	if err != nil {
+		return err
+	}
+	var stopped []*ReconcileJob
+	for _, job := range jobs {
+		if job.Status != ReconcileRunning {
+			stopped = append(stopped, job)
+		}
+	}
+	if len(stopped) < maxStoppedReconcileJobs {
+		return nil
+	}
+	sort.Slice(stopped, func(i, j int) bool { return stopped[i].UpdatedAt < stopped[j].UpdatedAt })
+	for _, job := range stopped[:len(stopped)-maxStoppedReconcileJobs+1] {
+		if err := vm.state.DeleteReconcileJob(job.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeReconcileJobs restarts the jobs that were running before a restart
+func (vm *VM) resumeReconcileJobs() error {
+	jobs, err := vm.state.GetReconcileJobs()
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Status != ReconcileRunning {
+			continue
+		}
+		log.Info("Resuming reconcile job", "job", job.ID, "checkpoint", job.Checkpoint, "end", job.End)
+		vm.runReconcileJob(job)
+	}
+	return nil
+}
+
+// cancelReconcileJob stops the running job [jobID]
+func (vm *VM) cancelReconcileJob(jobID ids.ID) (*ReconcileJob, error) {
+	job, err := vm.state.GetReconcileJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != ReconcileRunning {
+		return nil, fmt.Errorf("%w: %s is %s", errJobNotRunning, jobID, job.Status)
+	}
+	if run, ok := vm.reconcileJobs[jobID]; ok {
+		run.cancel()
+		delete(vm.reconcileJobs, jobID)
+	}
+	job.Status = ReconcileCancelled
+	job.UpdatedAt = time.Now().Unix()
+	if err := vm.state.PutReconcileJob(job); err != nil {
+		return nil, err
+	}
+	return job, vm.state.Commit()
+}
+
+// runReconcileJob checks the remaining heights of [job] in the background.
+// A batch that fails to reach zcashd is retried from the checkpoint with an
+// exponential backoff, any other error fails the job. It must be called with
+// the context lock held.
+func (vm *VM) runReconcileJob(job *ReconcileJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &reconcileRun{
+		start:  job.Start,
+		end:    job.End,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	vm.reconcileJobs[job.ID] = run
+	go func() {
+		defer close(run.done)
+		defer cancel()
+		go func() {
+			select {
+			case <-vm.shutdownChan:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		backoff := reconcileRetryBackoff
+		for job.Checkpoint <= job.End {
+			end := min(job.End, job.Checkpoint+reconcileBatchSize-1)
+			err := vm.reconcileBatch(ctx, job, end)
+			if ctx.Err() != nil {
+				// cancelled or shutting down, the state is up to date
+				return
+			}
+			switch {
+			case err == nil:
+				backoff = reconcileRetryBackoff
+			case errors.Is(err, errZcashUnavailable), errors.Is(err, errZcashTransient):
+				// The job stays running, so it also resumes from its
+				// checkpoint if the node restarts in the meantime
+				log.Warn("Reconcile job waiting for zcashd", "job", job.ID, "checkpoint", job.Checkpoint, "retryIn", backoff, "err", err)
+				job.Error = err.Error()
+				vm.saveReconcileJob(ctx, job)
+				timer := time.NewTimer(backoff)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				backoff = min(2*backoff, maxReconcileRetryBackoff)
+			default:
+				log.Warn("Reconcile job failed", "job", job.ID, "checkpoint", job.Checkpoint, "err", err)
+				job.Status = ReconcileFailed
+				job.Error = err.Error()
+				vm.saveReconcileJob(ctx, job)
+				return
+			}
+		}
+		log.Info("Reconcile job completed", "job", job.ID, "mismatched", len(job.Mismatched))
+	}()
+}
+
+// reconcileBatch checks the Zcash heights of [job] from its checkpoint to
+// [end], and moves its checkpoint past [end]
+func (vm *VM) reconcileBatch(ctx context.Context, job *ReconcileJob, end uint64) error {
+	entries, err := vm.reconcileEntries(job.Checkpoint, end)
+	if err != nil {
+		return err
+	}
+
+	var (
+		lock       sync.Mutex
+		wg         sync.WaitGroup
+		mismatched []uint64
+		superseded []uint64
+		errs       = make(chan error, job.Workers)
+		work       = make(chan reconcileEntry)
+	)
+	for i := uint32(0); i < job.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range work {
+				hash, err := vm.zcash.GetBlockHash(ctx, entry.height)
+				if err != nil {
+					errs <- fmt.Errorf("height %d: %w", entry.height, err)
+					return
+				}
+				lock.Lock()
+				for _, attestation := range entry.attestations {
+					if attestation.hash == hash {
+						continue
+					}
+					mismatched = append(mismatched, entry.height)
+					if attestation.superseded {
+						superseded = append(superseded, entry.height)
+					}
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	var workErr error
+dispatch:
+	for _, entry := range entries {
+		select {
+		case work <- entry:
+		case workErr = <-errs:
+			break dispatch
+		case <-ctx.Done():
+			workErr = ctx.Err()
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+	if workErr == nil {
+		select {
+		case workErr = <-errs:
+		default:
+		}
+	}
+	if workErr != nil {
+		return workErr
+	}
+
+	sort.Slice(mismatched, func(i, j int) bool { return mismatched[i] < mismatched[j] })
+	sort.Slice(superseded, func(i, j int) bool { return superseded[i] < superseded[j] })
+	job.Mismatched = append(job.Mismatched, mismatched...)
+	vm.metrics.reconcileMismatches.Add(float64(len(mismatched)))
+	job.Superseded = append(job.Superseded, superseded...)
+	job.Checkpoint = end + 1
+	job.Error = ""
+	if job.Checkpoint > job.End {
+		job.Status = ReconcileCompleted
+	}
+	vm.saveReconcileJob(ctx, job)
+	return nil
+}
+
+// reconcileEntries returns the attestations of the Zcash heights from
+// [start] to [end], including the ones superseded after a reorg
+func (vm *VM) reconcileEntries(start uint64, end uint64) ([]reconcileEntry, error) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() {
+		return nil, errShuttingDown
+	}
+	reorgs, err := vm.state.GetReorgs()
+	if err != nil {
+		return nil, err
+	}
+	originals := make(map[uint64][]reconcileAttestation)
+	for _, reorg := range reorgs {
+		if reorg.SupersededBy != ids.Empty {
+			originals[reorg.Height] = append(originals[reorg.Height], reconcileAttestation{
+				hash:       reorg.OriginalHash,
+				superseded: true,
+			})
+		}
+	}
+
+	var entries []reconcileEntry
+	for height := start; height <= end; height++ {
+		zblock, err := vm.getAttestedZcashBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		if zblock == nil {
+			continue
+		}
+		entries = append(entries, reconcileEntry{
+			height:       height,
+			attestations: append(originals[height], reconcileAttestation{hash: zblock.Hash}),
+		})
+	}
+	return entries, nil
+}
+
+// waitReconcileJob returns the job [jobID] once it stopped, or an error if
+// [ctx] is done first
+func (vm *VM) waitReconcileJob(ctx context.Context, jobID ids.ID) (*ReconcileJob, error) {
+	vm.snowCtx.Lock.Lock()
+	run, ok := vm.reconcileJobs[jobID]
+	vm.snowCtx.Lock.Unlock()
+	if ok {
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("reconcile job %s is still running: %w", jobID, ctx.Err())
+		}
+	}
+
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+	return vm.state.GetReconcileJob(jobID)
+}
+
+// saveReconcileJob persists [job] unless it was cancelled in the meantime
+func (vm *VM) saveReconcileJob(ctx context.Context, job *ReconcileJob) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if ctx.Err() != nil || vm.isShuttingDown() {
+		return
+	}
+	if job.Status != ReconcileRunning {
+		delete(vm.reconcileJobs, job.ID)
+	}
+	job.UpdatedAt = time.Now().Unix()
+	if err := vm.state.PutReconcileJob(job); err != nil {
+		log.Error("Failed to save reconcile job", "job", job.ID, "err", err)
+		return
+	}
+	if err := vm.state.Commit(); err != nil {
+		log.Error("Failed to save reconcile job", "job", job.ID, "err", err)
+	}
+}
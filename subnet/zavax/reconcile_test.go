@@ -0,0 +1,251 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/engine/common"
+	"github.com/ava-labs/avalanchego/snow/snowtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileJob(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	for height := uint64(30); height <= 35; height++ {
+		acceptZcashBlock(t, vm, height)
+	}
+	forkZcashSource(vm, 32)
+	forkZcashSource(vm, 34)
+
+	service := Service{vm: vm, tracker: vm.tracker}
+	started := ReconcileJobReply{}
+	require.NoError(service.StartReconcile(nil, &StartReconcileArgs{Start: 31, Workers: 2}, &started))
+	require.Equal(ReconcileRunning, started.Status)
+	require.Equal(uint64(35), uint64(started.End))
+	require.Equal(uint64(5), uint64(started.Total))
+
+	require.Eventually(func() bool {
+		reply := ReconcileJobReply{}
+		require.NoError(service.GetReconcileJob(nil, &ReconcileJobArgs{JobID: started.JobID}, &reply))
+		return reply.Status == ReconcileCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	report := GetReconcileReportReply{}
+	require.NoError(service.GetReconcileReport(nil, &ReconcileJobArgs{JobID: started.JobID}, &report))
+	require.Equal([]uint64{32, 34}, report.Height)
+	require.Empty(report.Superseded)
+
+	// A job can be cancelled before it completes
+	snowCtx.Lock.Lock()
+	job, err := vm.startReconcileJob(30, 35, 1)
+	require.NoError(err)
+	_, err = vm.cancelReconcileJob(job.ID)
+	require.NoError(err)
+	_, err = vm.cancelReconcileJob(job.ID)
+	require.ErrorIs(err, errJobNotRunning)
+	snowCtx.Lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	reply := ReconcileJobReply{}
+	require.NoError(service.GetReconcileJob(nil, &ReconcileJobArgs{JobID: job.ID}, &reply))
+	require.Equal(ReconcileCancelled, reply.Status)
+
+	require.ErrorIs(service.GetReconcileJob(nil, &ReconcileJobArgs{JobID: ids.GenerateTestID()}, &reply), errUnknownReconcileJob)
+	require.ErrorIs(service.StartReconcile(nil, &StartReconcileArgs{Start: 36}, &reply), errInvalidRange)
+	require.ErrorIs(service.StartReconcile(nil, &StartReconcileArgs{Workers: MaxReconcileWorkers + 1}, &reply), errInvalidWorkers)
+
+	snowCtx.Lock.Lock()
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
+
+// flakyZcashSource fails the first [failures] block hash requests
+type flakyZcashSource struct {
+	*testZcashSource
+	failures atomic.Int32
+}
+
+func (s *flakyZcashSource) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	if s.failures.Add(-1) >= 0 {
+		return "", fmt.Errorf("%w: connection refused", errZcashTransient)
+	}
+	return s.testZcashSource.GetBlockHash(ctx, height)
+}
+
+// require that a job waits out zcashd errors instead of failing
+func TestReconcileJobRetry(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	for height := uint64(30); height <= 33; height++ {
+		acceptZcashBlock(t, vm, height)
+	}
+	forkZcashSource(vm, 32)
+	src := &flakyZcashSource{testZcashSource: vm.zcash.(*testZcashSource)}
+	src.failures.Store(2)
+	vm.zcash = src
+
+	service := Service{vm: vm, tracker: vm.tracker}
+	started := ReconcileJobReply{}
+	require.NoError(service.StartReconcile(nil, &StartReconcileArgs{Start: 30, Workers: 1}, &started))
+	require.Eventually(func() bool {
+		reply := ReconcileJobReply{}
+		require.NoError(service.GetReconcileJob(nil, &ReconcileJobArgs{JobID: started.JobID}, &reply))
+		require.NotEqual(ReconcileFailed, reply.Status)
+		return reply.Status == ReconcileCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	report := GetReconcileReportReply{}
+	require.NoError(service.GetReconcileReport(nil, &ReconcileJobArgs{JobID: started.JobID}, &report))
+	require.Equal([]uint64{32}, report.Height)
+
+	snowCtx.Lock.Lock()
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
+
+// require that reconcile jobs are shared by range, capped and pruned
+func TestReconcileJobLimits(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	for height := uint64(30); height <= 35; height++ {
+		acceptZcashBlock(t, vm, height)
+	}
+	// zcashd stays unreachable, so the jobs keep running
+	src := &flakyZcashSource{testZcashSource: vm.zcash.(*testZcashSource)}
+	src.failures.Store(math.MaxInt32)
+	vm.zcash = src
+
+	// ReconcileBlocks joins the job already running over the default range
+	service := Service{vm: vm, tracker: vm.tracker}
+	started := ReconcileJobReply{}
+	require.NoError(service.StartReconcile(nil, &StartReconcileArgs{}, &started))
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	r := httptest.NewRequest("POST", "/", nil).WithContext(cancelled)
+	err = service.ReconcileBlocks(r, nil, &GetReconcileReply{})
+	require.ErrorIs(err, context.Canceled)
+	require.ErrorContains(err, started.JobID.String())
+
+	snowCtx.Lock.Lock()
+	require.Len(vm.reconcileJobs, 1)
+	same, err := vm.startReconcileJob(0, 0, 2)
+	require.NoError(err)
+	require.Equal(started.JobID, same.ID)
+
+	jobIDs := []ids.ID{started.JobID}
+	for start := uint64(30); len(jobIDs) < MaxReconcileJobs; start++ {
+		job, err := vm.startReconcileJob(start, 35, 1)
+		require.NoError(err)
+		jobIDs = append(jobIDs, job.ID)
+	}
+	_, err = vm.startReconcileJob(34, 35, 1)
+	require.ErrorIs(err, errTooManyJobs)
+	for _, jobID := range jobIDs {
+		_, err := vm.cancelReconcileJob(jobID)
+		require.NoError(err)
+	}
+
+	// Starting a job deletes the least recently updated stopped ones
+	var old []ids.ID
+	for i := 0; i < maxStoppedReconcileJobs; i++ {
+		job := &ReconcileJob{
+			ID:        ids.GenerateTestID(),
+			Start:     30,
+			End:       35,
+			Workers:   1,
+			Status:    ReconcileCompleted,
+			UpdatedAt: int64(i + 1),
+		}
+		require.NoError(vm.state.PutReconcileJob(job))
+		old = append(old, job.ID)
+	}
+	job, err := vm.startReconcileJob(34, 35, 1)
+	require.NoError(err)
+	jobs, err := vm.state.GetReconcileJobs()
+	require.NoError(err)
+	// room is left for the new job once it stops
+	require.Len(jobs, maxStoppedReconcileJobs)
+	excess := len(jobIDs) + 1
+	for i, jobID := range old {
+		_, err := vm.state.GetReconcileJob(jobID)
+		if i < excess {
+			require.ErrorIs(err, errUnknownReconcileJob)
+		} else {
+			require.NoError(err)
+		}
+	}
+	for _, jobID := range append(jobIDs, job.ID) {
+		_, err := vm.state.GetReconcileJob(jobID)
+		require.NoError(err)
+	}
+
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
+
+// require that a job interrupted by a restart resumes from its checkpoint
+func TestResumeReconcileJob(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	for height := uint64(30); height <= 33; height++ {
+		acceptZcashBlock(t, vm, height)
+	}
+	forkZcashSource(vm, 33)
+
+	// The heights below the checkpoint were checked before the restart
+	job := &ReconcileJob{
+		ID:         ids.GenerateTestID(),
+		Start:      30,
+		End:        33,
+		Workers:    1,
+		Status:     ReconcileRunning,
+		Checkpoint: 32,
+		Mismatched: []uint64{30},
+	}
+	require.NoError(vm.state.PutReconcileJob(job))
+	require.NoError(vm.state.Commit())
+	require.NoError(vm.Shutdown(ctx))
+
+	restarted := &VM{zcash: vm.zcash, equihashN: vm.equihashN, equihashK: vm.equihashK}
+	config, err := json.Marshal(vm.config)
+	require.NoError(err)
+	snowCtx := snowtest.Context(t, blockchainID)
+	require.NoError(restarted.Initialize(ctx, snowCtx, vm.dbManager, []byte{0, 0, 0, 0, 0}, nil, config, make(chan common.Message, 1), nil, nil))
+
+	var resumed *ReconcileJob
+	require.Eventually(func() bool {
+		snowCtx.Lock.Lock()
+		defer snowCtx.Lock.Unlock()
+		resumed, err = restarted.state.GetReconcileJob(job.ID)
+		require.NoError(err)
+		return resumed.Status == ReconcileCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal([]uint64{30, 33}, resumed.Mismatched)
+	require.Equal(uint64(34), resumed.Checkpoint)
+
+	snowCtx.Lock.Lock()
+	require.NoError(restarted.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
@@ -0,0 +1,350 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+
+	log "github.com/inconshreveable/log15"
+)
+
+var (
+	errInvalidCorrection = errors.New("invalid zcash block correction")
+
+	_ ReorgState = &reorgState{}
+)
+
+// Reorg is a Zcash reorg that replaced the Zcash block attested at Height by
+// the accepted block Original
+type Reorg struct {
+	Height       uint64 `serialize:"true" json:"height"`
+	Original     ids.ID `serialize:"true" json:"original"`
+	OriginalHash string `serialize:"true" json:"originalHash"`
+	// Correction attests the Zcash block now at Height
+	Correction Attestation `serialize:"true" json:"correction"`
+	// DetectedAt is the unix time the reorg was detected, or the timestamp
+	// of the correcting block on validators that didn't detect it
+	DetectedAt int64 `serialize:"true" json:"detectedAt"`
+	// SupersededBy is the accepted block attesting Correction, empty until
+	// it is accepted
+	SupersededBy ids.ID `serialize:"true" json:"supersededBy"`
+}
+
+// ReorgState persists the detected Zcash reorgs, keyed by Zcash height and
+// original block
+type ReorgState interface {
+	// GetReorgs returns every reorg by ascending Zcash height
+	GetReorgs() ([]*Reorg, error)
+	// GetReorg returns nil if no reorg of [height] attested by [original]
+	// was recorded
+	GetReorg(height uint64, original ids.ID) (*Reorg, error)
+	PutReorg(reorg *Reorg) error
+	DeleteReorg(height uint64, original ids.ID) error
+}
+
+type reorgState struct {
+	// Zcash height + original block ID --> Reorg
+	reorgDB database.Database
+}
+
+// NewReorgState returns ReorgState with the given db
+func NewReorgState(db database.Database) ReorgState {
+	return &reorgState{
+		reorgDB: db,
+	}
+}
+
+func reorgKey(height uint64, original ids.ID) []byte {
+	return append(heightKey(height), original[:]...)
+}
+
+func (s *reorgState) GetReorgs() ([]*Reorg, error) {
+	it := s.reorgDB.NewIterator()
+	defer it.Release()
+
+	var reorgs []*Reorg
+	for it.Next() {
+		reorg := &Reorg{}
+		if _, err := Codec.Unmarshal(it.Value(), reorg); err != nil {
+			return nil, err
+		}
+		reorgs = append(reorgs, reorg)
+	}
+	return reorgs, it.Error()
+}
+
+func (s *reorgState) GetReorg(height uint64, original ids.ID) (*Reorg, error) {
+	bytes, err := s.reorgDB.Get(reorgKey(height, original))
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reorg := &Reorg{}
+	if _, err := Codec.Unmarshal(bytes, reorg); err != nil {
+		return nil, err
+	}
+	return reorg, nil
+}
+
+func (s *reorgState) PutReorg(reorg *Reorg) error {
+	bytes, err := Codec.Marshal(CodecVersion, reorg)
+	if err != nil {
+		return err
+	}
+	return s.reorgDB.Put(reorgKey(reorg.Height, reorg.Original), bytes)
+}
+
+func (s *reorgState) DeleteReorg(height uint64, original ids.ID) error {
+	return s.reorgDB.Delete(reorgKey(height, original))
+}
+
+// attestedZcashBlock is the Zcash block attested at a height by an accepted
+// block
+type attestedZcashBlock struct {
+	height uint64
+	hash   string
+	blkID  ids.ID
+}
+
+// watchReorgs checks the latest ReorgDepth attested Zcash blocks every
+// ReorgInterval, until the VM shuts down
+func (vm *VM) watchReorgs() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-vm.shutdownChan
+		cancel()
+	}()
+
+	log.Info("Watching zcash reorgs", "depth", vm.config.ReorgDepth)
+	ticker := time.NewTicker(vm.config.ReorgInterval.Duration)
+	defer ticker.Stop()
+	for {
+		vm.watchReorgsOnce(ctx)
+		select {
+		case <-ctx.Done():
+			log.Info("Stopped watching zcash reorgs")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchReorgsOnce compares the latest ReorgDepth attested Zcash blocks with
+// zcashd, and records a reorg for each one that was replaced by a final
+// Zcash block
+func (vm *VM) watchReorgsOnce(ctx context.Context) {
+	attested, ok := vm.latestAttestations()
+	if !ok {
+		return
+	}
+	for _, a := range attested {
+		hash, err := vm.zcash.GetBlockHash(ctx, a.height)
+		if err != nil {
+			log.Warn("Failed to fetch zcash block hash", "height", a.height, "err", err)
+			return
+		}
+		if hash == a.hash {
+			// A reorg detected earlier may have been reverted since
+			vm.clearReorg(a)
+			continue
+		}
+
+		// The replacing block must be final as well before it's attested
+		zblock, err := vm.queryZcashBlock(ctx, a.height, true)
+		if err != nil {
+			log.Warn("Failed to fetch replacing zcash block", "height", a.height, "err", err)
+			continue
+		}
+		if zblock.Hash == a.hash {
+			continue
+		}
+		vm.recordReorg(a, zblock)
+	}
+}
+
+// latestAttestations returns the latest ReorgDepth attested Zcash blocks. ok
+// is false if the VM is shutting down or the index can't be read.
+func (vm *VM) latestAttestations() ([]attestedZcashBlock, bool) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() {
+		return nil, false
+	}
+	highest, err := vm.state.GetHighestZcashHeight()
+	if err != nil {
+		log.Error("Failed to read highest attested zcash height", "err", err)
+		return nil, false
+	}
+
+	var attested []attestedZcashBlock
+	for height := highest; height > 0 && height+vm.config.ReorgDepth > highest; height-- {
+		blkID, err := vm.state.GetBlockIDByZcashHeight(height)
+		if err == database.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.Error("Failed to read zcash index", "height", height, "err", err)
+			return nil, false
+		}
+		zblock, err := vm.getAttestedZcashBlock(height)
+		if err != nil || zblock == nil {
+			log.Error("Failed to read attested zcash block", "height", height, "err", err)
+			return nil, false
+		}
+		attested = append(attested, attestedZcashBlock{
+			height: height,
+			hash:   zblock.Hash,
+			blkID:  blkID,
+		})
+	}
+	return attested, true
+}
+
+// recordReorg records that [zblock] replaced the attested Zcash block [a],
+// unless [a] was superseded since it was read
+func (vm *VM) recordReorg(a attestedZcashBlock, zblock *ZcashBlock) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() {
+		return
+	}
+	blkID, err := vm.state.GetBlockIDByZcashHeight(a.height)
+	if err != nil || blkID != a.blkID {
+		return
+	}
+	existing, err := vm.state.GetReorg(a.height, a.blkID)
+	if err != nil {
+		log.Error("Failed to read zcash reorg", "height", a.height, "err", err)
+		return
+	}
+	if existing != nil && existing.Correction.Hash == zblock.Hash {
+		return
+	}
+
+	log.Warn("Detected zcash reorg", "height", a.height, "attested", a.hash, "zcash", zblock.Hash, "block", a.blkID)
+	reorg := &Reorg{
+		Height:       a.height,
+		Original:     a.blkID,
+		OriginalHash: a.hash,
+		Correction:   newAttestation(zblock),
+		DetectedAt:   time.Now().Unix(),
+	}
+	if err := vm.state.PutReorg(reorg); err != nil {
+		log.Error("Failed to record zcash reorg", "height", a.height, "err", err)
+		return
+	}
+	if err := vm.state.Commit(); err != nil {
+		log.Error("Failed to record zcash reorg", "height", a.height, "err", err)
+		return
+	}
+	vm.NotifyBlockReady()
+}
+
+// clearReorg forgets the pending correction of [a], whose Zcash block is
+// back in the Zcash chain
+func (vm *VM) clearReorg(a attestedZcashBlock) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() {
+		return
+	}
+	existing, err := vm.state.GetReorg(a.height, a.blkID)
+	if err != nil || existing == nil || existing.SupersededBy != ids.Empty {
+		return
+	}
+	log.Info("Zcash reorg was reverted", "height", a.height, "hash", a.hash)
+	if err := vm.state.DeleteReorg(a.height, a.blkID); err != nil {
+		log.Error("Failed to delete zcash reorg", "height", a.height, "err", err)
+		return
+	}
+	if err := vm.state.Commit(); err != nil {
+		log.Error("Failed to delete zcash reorg", "height", a.height, "err", err)
+	}
+}
+
+// pendingCorrections returns the corrections of the recorded reorgs that are
+// neither accepted nor attested by [pending]
+func (vm *VM) pendingCorrections(pending *attestationSet) ([]Correction, error) {
+	reorgs, err := vm.state.GetReorgs()
+	if err != nil {
+		return nil, err
+	}
+	var corrections []Correction
+	for _, reorg := range reorgs {
+		if reorg.SupersededBy != ids.Empty || pending.HasHeight(reorg.Height) {
+			continue
+		}
+		// Skip the reorgs whose original attestation was superseded by a
+		// correction this node didn't record
+		blkID, err := vm.state.GetBlockIDByZcashHeight(reorg.Height)
+		if err != nil {
+			return nil, err
+		}
+		if blkID != reorg.Original {
+			continue
+		}
+		corrections = append(corrections, Correction{
+			Supersedes:  reorg.Original,
+			Attestation: reorg.Correction,
+		})
+	}
+	return corrections, nil
+}
+
+// verifyCorrection returns nil iff [c] re-attests a Zcash height that is
+// attested by the accepted block it supersedes and by no block in [pending]
+func (vm *VM) verifyCorrection(c *Correction, pending *attestationSet) error {
+	height := c.Attestation.Height
+	if pending.HasHeight(height) {
+		return fmt.Errorf("%w: height %d", errBlockAlreadyReq, height)
+	}
+	blkID, err := vm.state.GetBlockIDByZcashHeight(height)
+	if err == database.ErrNotFound || (err == nil && blkID != c.Supersedes) {
+		return fmt.Errorf("%w: height %d isn't attested by %s", errInvalidCorrection, height, c.Supersedes)
+	}
+	if err != nil {
+		return err
+	}
+	original, err := vm.getAttestedZcashBlock(height)
+	if err != nil {
+		return err
+	}
+	if original.Hash == c.Attestation.Hash {
+		return fmt.Errorf("%w: height %d is already attested with hash %s", errInvalidCorrection, height, original.Hash)
+	}
+	return nil
+}
+
+// supersede records that the accepted block [blkID] corrects the attestation
+// of [c]. [originalHash] is the hash [c] replaces.
+func (vm *VM) supersede(c *Correction, originalHash string, blkID ids.ID, timestamp int64) error {
+	height := c.Attestation.Height
+	reorg, err := vm.state.GetReorg(height, c.Supersedes)
+	if err != nil {
+		return err
+	}
+	if reorg == nil {
+		reorg = &Reorg{
+			Height:       height,
+			Original:     c.Supersedes,
+			OriginalHash: originalHash,
+			DetectedAt:   timestamp,
+		}
+	}
+	reorg.Correction = c.Attestation
+	reorg.SupersededBy = blkID
+	return vm.state.PutReorg(reorg)
+}
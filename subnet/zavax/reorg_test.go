@@ -0,0 +1,123 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgCorrection(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	// Only heights above the confirmation window are reconciled
+	vm, _, msgChan, err := newTestVM(t)
+	require.NoError(err)
+	acceptZcashBlock(t, vm, 30)
+	original := acceptZcashBlock(t, vm, 31)
+	acceptZcashBlock(t, vm, 32)
+	originalZblock, err := vm.getAttestedZcashBlock(31)
+	require.NoError(err)
+
+	// Zcash height 31 is replaced by a reorg
+	forkZcashSource(vm, 31)
+	vm.watchReorgsOnce(ctx)
+	<-msgChan
+
+	reorgs, err := vm.state.GetReorgs()
+	require.NoError(err)
+	require.Len(reorgs, 1)
+	require.Equal(uint64(31), reorgs[0].Height)
+	require.Equal(original.ID(), reorgs[0].Original)
+	require.Equal(originalZblock.Hash, reorgs[0].OriginalHash)
+	require.Equal(ids.Empty, reorgs[0].SupersededBy)
+
+	service := Service{vm: vm, tracker: vm.tracker}
+	request := httptest.NewRequest("POST", "/", nil)
+	report := GetReconcileReply{}
+	require.NoError(service.ReconcileBlocks(request, nil, &report))
+	require.Equal([]uint64{31}, report.Height)
+	require.Empty(report.Superseded)
+
+	// The correction is built before the mempool
+	proposeZcashBlock(t, vm, 33)
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	correction := blk.(*Block)
+	require.NoError(correction.Verify(ctx))
+	require.NoError(correction.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, correction.ID()))
+
+	reorgs, err = vm.state.GetReorgs()
+	require.NoError(err)
+	require.Len(reorgs, 1)
+	require.Equal(correction.ID(), reorgs[0].SupersededBy)
+
+	// Both the original and the corrected data remain available
+	reply := GetBlockReply{}
+	require.NoError(service.GetBlockByHeight(nil, &QueryDataArgs{ID: 31}, &reply))
+	require.Equal(correction.ID(), reply.ID)
+	require.Equal(reorgs[0].Correction.Hash, reply.Data.Hash)
+	require.Equal([]ids.ID{original.ID()}, reply.Supersedes)
+	originalReply := GetBlockReply{}
+	require.NoError(service.GetBlock(nil, &GetBlockArgs{ID: &reply.Supersedes[0]}, &originalReply))
+	require.Equal(originalZblock.Hash, originalReply.Data.Hash)
+
+	report = GetReconcileReply{}
+	require.NoError(service.ReconcileBlocks(request, nil, &report))
+	require.Equal([]uint64{31}, report.Height)
+	require.Equal([]uint64{31}, report.Superseded)
+
+	// The superseded attestation can't be corrected again
+	zblock, err := vm.queryZcashBlock(ctx, 31, true)
+	require.NoError(err)
+	data, err := encodePayload(&CorrectionPayload{Corrections: []Correction{{
+		Supersedes:  original.ID(),
+		Attestation: newAttestation(zblock),
+	}}})
+	require.NoError(err)
+	again, err := vm.NewBlock(correction.ID(), correction.Height()+1, data, time.Now())
+	require.NoError(err)
+	require.ErrorIs(again.Verify(ctx), errInvalidCorrection)
+
+	// The mempool is built next
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	requireZcashHeight(t, blk.(*Block), 33)
+}
+
+func TestReorgReverted(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, msgChan, err := newTestVM(t)
+	require.NoError(err)
+	acceptZcashBlock(t, vm, 1)
+
+	src := vm.zcash.(*testZcashSource)
+	attested := src.blocks[1]
+	forkZcashSource(vm, 1)
+	vm.watchReorgsOnce(ctx)
+	<-msgChan
+	reorgs, err := vm.state.GetReorgs()
+	require.NoError(err)
+	require.Len(reorgs, 1)
+
+	// The attested block is back in the Zcash chain before the correction
+	// is accepted
+	src.blocks[1] = attested
+	vm.watchReorgsOnce(ctx)
+	reorgs, err = vm.state.GetReorgs()
+	require.NoError(err)
+	require.Empty(reorgs)
+
+	_, err = vm.BuildBlock(ctx)
+	require.ErrorIs(err, errNoPendingBlocks)
+}
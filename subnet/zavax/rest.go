@@ -0,0 +1,206 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/choices"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// RESTRoutes are the chain API extensions served by the REST handler
+var RESTRoutes = []string{
+	"/blocks/latest",
+	"/blocks/{id}",
+	"/zcash/height/{height}",
+	"/zcash/hash/{hash}",
+}
+
+// Cache-Control of the REST replies. A block fetched by ID never changes once
+// accepted, while the other routes may point to a newer block.
+const (
+	cacheImmutable   = "public, max-age=31536000, immutable"
+	cacheRevalidated = "no-cache"
+)
+
+var errInvalidZcashHash = errors.New("invalid zcash block hash")
+
+// restHandler serves the accepted blocks as GetBlockReply over plain HTTP GET
+// requests
+type restHandler struct {
+	vm  *VM
+	mux *http.ServeMux
+}
+
+func newRESTHandler(vm *VM) *restHandler {
+	h := &restHandler{
+		vm:  vm,
+		mux: http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /blocks/latest", h.getLatestBlock)
+	h.mux.HandleFunc("GET /blocks/{id}", h.getBlock)
+	h.mux.HandleFunc("GET /zcash/height/{height}", h.getZcashHeight)
+	h.mux.HandleFunc("GET /zcash/hash/{hash}", h.getZcashHash)
+	return h
+}
+
+// ServeHTTP routes the request by its path within the chain's API. The API
+// server hands over the full path, starting with /ext/bc/<chain>.
+func (h *restHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/ext/bc/"); ok {
+		i := strings.Index(rest, "/")
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.URL.Path = rest[i:]
+		r.URL.RawPath = ""
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *restHandler) getLatestBlock(w http.ResponseWriter, r *http.Request) {
+	h.vm.snowCtx.Lock.Lock()
+	defer h.vm.snowCtx.Lock.Unlock()
+
+	blkID, err := h.vm.state.GetLastAccepted()
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, errCannotGetLastAccepted)
+		return
+	}
+	blk, err := h.vm.getBlock(blkID)
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply := GetBlockReply{}
+	assignValues(&reply, blk)
+	writeBlockReply(w, r, blk, &reply, cacheRevalidated)
+}
+
+func (h *restHandler) getBlock(w http.ResponseWriter, r *http.Request) {
+	blkID, err := ids.FromString(r.PathValue("id"))
+	if err != nil {
+		writeRESTError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.vm.snowCtx.Lock.Lock()
+	defer h.vm.snowCtx.Lock.Unlock()
+
+	blk, err := h.vm.getBlock(blkID)
+	if err == database.ErrNotFound || (err == nil && blk.Status() != choices.Accepted) {
+		writeRESTError(w, http.StatusNotFound, errNoSuchBlock)
+		return
+	}
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply := GetBlockReply{}
+	assignValues(&reply, blk)
+	writeBlockReply(w, r, blk, &reply, cacheImmutable)
+}
+
+func (h *restHandler) getZcashHeight(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseUint(r.PathValue("height"), 10, 64)
+	if err != nil || height == 0 {
+		writeRESTError(w, http.StatusBadRequest, fmt.Errorf("invalid zcash height %q", r.PathValue("height")))
+		return
+	}
+
+	h.vm.snowCtx.Lock.Lock()
+	defer h.vm.snowCtx.Lock.Unlock()
+
+	blk, err := h.vm.getBlockByHeight(height)
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if blk == nil {
+		writeRESTError(w, http.StatusNotFound, errNoSuchBlock)
+		return
+	}
+	reply := GetBlockReply{}
+	assignZcashValues(&reply, blk, height)
+	writeBlockReply(w, r, blk, &reply, cacheRevalidated)
+}
+
+func (h *restHandler) getZcashHash(w http.ResponseWriter, r *http.Request) {
+	hash := strings.ToLower(r.PathValue("hash"))
+	if raw, err := hex.DecodeString(hash); err != nil || len(raw) != 32 {
+		writeRESTError(w, http.StatusBadRequest, fmt.Errorf("%w: %q", errInvalidZcashHash, r.PathValue("hash")))
+		return
+	}
+
+	h.vm.snowCtx.Lock.Lock()
+	defer h.vm.snowCtx.Lock.Unlock()
+
+	blkID, err := h.vm.state.GetBlockIDByZcashHash(hash)
+	if err == database.ErrNotFound {
+		writeRESTError(w, http.StatusNotFound, errNoSuchBlock)
+		return
+	}
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, err)
+		return
+	}
+	blk, err := h.vm.getBlock(blkID)
+	if err != nil {
+		writeRESTError(w, http.StatusInternalServerError, err)
+		return
+	}
+	reply := GetBlockReply{}
+	assignMatchingValues(&reply, blk, func(zblock *ZcashBlock) bool {
+		return zblock.Hash == hash
+	})
+	writeBlockReply(w, r, blk, &reply, cacheRevalidated)
+}
+
+// writeBlockReply writes [reply] with the ID of [blk] as its ETag, or only
+// the headers if the client already holds that block
+func writeBlockReply(w http.ResponseWriter, r *http.Request, blk *Block, reply *GetBlockReply, cacheControl string) {
+	etag := `"` + blk.ID().String() + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeRESTJSON(w, http.StatusOK, reply)
+}
+
+// etagMatches returns true if the If-None-Match header [header] lists [etag]
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeRESTError(w http.ResponseWriter, status int, err error) {
+	writeRESTJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeRESTJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Debug("Failed to write REST reply", "err", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESTHandler(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	first := acceptZcashBlock(t, vm, 30)
+	latest := acceptZcashBlock(t, vm, 31)
+	zblock, err := vm.getAttestedZcashBlock(31)
+	require.NoError(err)
+
+	handlers, err := vm.CreateHandlers(ctx)
+	require.NoError(err)
+	for _, route := range RESTRoutes {
+		require.Contains(handlers, route)
+	}
+	server := httptest.NewServer(handlers[RESTRoutes[0]])
+	defer server.Close()
+	base := server.URL + "/ext/bc/" + vm.snowCtx.ChainID.String()
+
+	get := func(path string, header http.Header) (*http.Response, *GetBlockReply) {
+		req, err := http.NewRequest(http.MethodGet, base+path, nil)
+		require.NoError(err)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(err)
+		defer resp.Body.Close()
+		reply := &GetBlockReply{}
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(json.NewDecoder(resp.Body).Decode(reply))
+		}
+		return resp, reply
+	}
+
+	resp, reply := get("/blocks/latest", nil)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal(latest.ID(), reply.ID)
+	require.Equal(cacheRevalidated, resp.Header.Get("Cache-Control"))
+
+	// Accepted blocks are immutable
+	resp, reply = get("/blocks/"+first.ID().String(), nil)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal(30, reply.Data.Height)
+	require.Equal(`"`+first.ID().String()+`"`, resp.Header.Get("ETag"))
+	require.Equal(cacheImmutable, resp.Header.Get("Cache-Control"))
+	resp, _ = get("/blocks/"+first.ID().String(), http.Header{"If-None-Match": {resp.Header.Get("ETag")}})
+	require.Equal(http.StatusNotModified, resp.StatusCode)
+
+	resp, reply = get("/zcash/height/31", nil)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal(latest.ID(), reply.ID)
+	require.Equal(zblock.Hash, reply.Data.Hash)
+
+	resp, reply = get("/zcash/hash/"+strings.ToUpper(zblock.Hash), nil)
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.Equal(latest.ID(), reply.ID)
+	require.Equal(31, reply.Data.Height)
+
+	unknownHash := strings.Repeat("00", 32)
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{path: "/blocks/" + ids.GenerateTestID().String(), status: http.StatusNotFound},
+		{path: "/blocks/foo", status: http.StatusBadRequest},
+		{path: "/zcash/height/32", status: http.StatusNotFound},
+		{path: "/zcash/height/0", status: http.StatusBadRequest},
+		{path: "/zcash/hash/" + unknownHash, status: http.StatusNotFound},
+		{path: "/zcash/hash/00", status: http.StatusBadRequest},
+		{path: "/unknown", status: http.StatusNotFound},
+	} {
+		resp, _ := get(test.path, nil)
+		require.Equal(test.status, resp.StatusCode, test.path)
+	}
+
+	resp, err = http.Post(base+"/blocks/latest", "application/json", nil)
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+}
@@ -4,24 +4,36 @@
 package zavax
 
 import (
+	"context"
+	ej "encoding/json"
 	"errors"
-	"net/http"
 	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ava-labs/avalanchego/database"
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/utils/json"
-	ej "encoding/json"
+
+	log "github.com/inconshreveable/log15"
 )
 
 var (
 	errNoSuchBlock           = errors.New("Couldn't find a block with this height in the blockchain. Does it exist?")
 	errCannotGetLastAccepted = errors.New("problem getting last accepted")
-	errNoSuchData  = errors.New("No data found!!")
+	errNoSuchData            = errors.New("No data found!!")
+	errTooManyHeights        = errors.New("too many zcash heights requested")
+	errNoSuchZcashHash       = errors.New("no attested zcash block has this hash")
+	errNoSuchTx              = errors.New("no attested zcash block includes this transaction")
 )
 
 // Service is the API service for this VM
-type Service struct { 
-	vm *VM
-	tracker *RequestTracker 
+type Service struct {
+	vm      *VM
+	tracker *RequestTracker
 }
 
 // GetBlockArgs are the arguments to GetBlock
@@ -34,10 +46,16 @@ type GetBlockArgs struct {
 // GetBlockReply is the reply from GetBlock
 type GetBlockReply struct {
 	Timestamp json.Uint64 `json:"timestamp"` // Timestamp of block
-	Data      ZcashBlock  `json:"data"`  	 // Data of zcash block
+	Data      ZcashBlock  `json:"data"`      // Data of zcash block
 	Height    json.Uint64 `json:"height"`    // Height of block
 	ID        ids.ID      `json:"id"`        // String repr. of ID of block
 	ParentID  ids.ID      `json:"parentID"`  // String repr. of ID of block's parent
+
+	// Every Zcash block attested by the block, when it attests more than one
+	Attestations []ZcashBlock `json:"attestations,omitempty"`
+	// Blocks whose attestations of the same Zcash heights were replaced by
+	// a Zcash reorg and are corrected by the block, in attestation order
+	Supersedes []ids.ID `json:"supersedes,omitempty"`
 }
 
 // GetBlock gets the block whose ID is [args.ID]
@@ -50,6 +68,9 @@ func (s *Service) GetBlock(_ *http.Request, args *GetBlockArgs, reply *GetBlockR
 		err error
 	)
 
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
 	if args.ID == nil {
 		id, err = s.vm.state.GetLastAccepted()
 		if err != nil {
@@ -73,17 +94,19 @@ func (s *Service) GetBlock(_ *http.Request, args *GetBlockArgs, reply *GetBlockR
 
 type QueryDataArgs struct {
 	ID uint64 `json:"id"`
+	// Wait blocks until the attestation of a pending Zcash block is accepted
+	// or dropped, for at most Timeout (DefaultWaitTimeout if unset)
+	Wait    bool     `json:"wait"`
+	Timeout Duration `json:"timeout"`
 }
 
-
-
 // GetBlock gets the block whose ID is [args.ID]
 // If [args.ID] is empty, get the latest block
-func (s *Service) GetBlockByHeight(_ *http.Request, args *QueryDataArgs, reply *GetBlockReply) error {
-
+// If [args.Wait] is set, wait for a pending Zcash block to be attested
+func (s *Service) GetBlockByHeight(r *http.Request, args *QueryDataArgs, reply *GetBlockReply) error {
 
 	var (
-		id  uint64
+		id uint64
 	)
 
 	if args.ID == 0 {
@@ -91,89 +114,783 @@ func (s *Service) GetBlockByHeight(_ *http.Request, args *QueryDataArgs, reply *
 	} else {
 		id = args.ID
 	}
+	if args.Wait && (args.Timeout.Duration < 0 || args.Timeout.Duration > MaxWaitTimeout) {
+		return fmt.Errorf("%w: %s must be within 0s and %s", errInvalidWaitTimeout, args.Timeout.Duration, MaxWaitTimeout)
+	}
 
-	block, err := s.vm.getBlockByHeight(id)
+	found, err := s.getAttestedBlock(id, reply)
+	if err != nil || found {
+		return err
+	}
+
+	// Get the block from zcashd
+	resp, err := s.vm.queryZcashBlock(r.Context(), id, true)
 	if err != nil {
-		fmt.Printf("Error in finding getBlockByHeight : %+v\n", err)
+		return err
+	}
+	data, err := ej.Marshal(resp)
+	if err != nil {
+		return err
 	}
 
-	if block ==  nil {
-		// Get the block from the database
-		resp, err := s.vm.queryZcashBlock(id, true)
-		if err != nil {
-			return err
-		}		
-
-		jsonData, err := ej.Marshal(resp)
-		
-		byteArray := []byte(jsonData)
-
-		if len(byteArray) > 0 {
-			//fmt.Printf(" Check tracker%v %d\n", s.tracker.IsProcessing(id),id)
-			processingCh := s.tracker.IsProcessing(id)
-			//fmt.Printf("Processing status for block %d: %v\n", id, processingCh)
-			if processingCh != nil {
-				fmt.Printf("Block with ID %d is already being processed\n", id)
-			} else {
-				go func() {
-                    s.tracker.MarkProcessing(id)
-                    //fmt.Printf("Processing started for block %d\n", id)
-                    status := s.vm.addZcashBlock(byteArray)
-                    fmt.Printf("Block added into subnet: %+v %+v\n", status, resp.Height)
-                    s.tracker.CompleteProcessing(id)
-                    //fmt.Printf("Processing completed for block %d\n", id)
-                }()
-			}
-		}		
-		
+	if args.Wait {
+		return s.waitForBlock(r.Context(), id, data, args.Timeout.Duration, reply)
+	}
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+	return s.queueZcashBlock(id, data)
+}
+
+// getAttestedBlock assigns the accepted block attesting the Zcash block at
+// [height] to [reply], and returns false if there is none
+func (s *Service) getAttestedBlock(height uint64, reply *GetBlockReply) (bool, error) {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	block, err := s.vm.getBlockByHeight(height)
+	if err != nil || block == nil {
+		return false, err
+	}
+	assignZcashValues(reply, block, height)
+	return true, nil
+}
+
+// waitForBlock adds [data], the Zcash block at [height], to the mempool
+// unless it's already attested or pending, and waits up to [timeout] for its
+// attestation to be accepted
+func (s *Service) waitForBlock(ctx context.Context, height uint64, data []byte, timeout time.Duration, reply *GetBlockReply) error {
+	if timeout == 0 {
+		timeout = DefaultWaitTimeout
+	}
+
+	// Wait before adding the block so its acceptance can't be missed
+	s.vm.snowCtx.Lock.Lock()
+	result, cancel := s.vm.waiters.wait(height)
+	defer cancel()
+	block, err := s.vm.getBlockByHeight(height)
+	if err == nil && block == nil {
+		err = s.queueZcashBlock(height, data)
+	}
+	s.vm.snowCtx.Lock.Unlock()
+	if err != nil {
 		return err
+	}
 
-	} else {	
-		fmt.Printf("block found in subnet check : %+v\n", block.Height)
-		// Assign values from resp to reply
-		assignValues(reply, block)
+	if block == nil {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case res := <-result:
+			if res.err != nil {
+				return res.err
+			}
+			block = res.blk
+		case <-timer.C:
+			return fmt.Errorf("%w: height %d after %s", errWaitTimeout, height, timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	assignZcashValues(reply, block, height)
+	return nil
+}
+
+// queueZcashBlock adds [data], the Zcash block at [height], to the mempool
+// and tracks its request, unless it's already pending. The snow context lock
+// must be held.
+func (s *Service) queueZcashBlock(height uint64, data []byte) error {
+	status, err := s.tracker.Status(height)
+	if err != nil {
+		return err
+	}
+	if status != nil && !status.final() && s.vm.mempool.Has(height) {
+		log.Debug("Zcash block is already being attested", "zcashHeight", height)
+		s.vm.metrics.dedupeHits.WithLabelValues(dedupeMempool).Inc()
 		return nil
-	}	
-	
+	}
+	if err := s.vm.addZcashBlock(data); err != nil {
+		return err
+	}
+	s.tracker.Queued(height)
+	log.Debug("Added zcash block to the mempool", "zcashHeight", height)
+	return s.vm.state.Commit()
+}
+
+// assignZcashValues assigns the values of [block] to [reply], with the Zcash
+// block attested at [height] as its Data
+func assignZcashValues(reply *GetBlockReply, block *Block, height uint64) {
+	assignMatchingValues(reply, block, func(zblock *ZcashBlock) bool {
+		return uint64(zblock.Height) == height
+	})
+}
+
+// assignMatchingValues assigns the values of [block] to [reply], with the
+// attested Zcash block [match] returns true for as its Data
+func assignMatchingValues(reply *GetBlockReply, block *Block, match func(*ZcashBlock) bool) {
+	assignValues(reply, block)
+	for _, zblock := range reply.Attestations {
+		if match(&zblock) {
+			reply.Data = zblock
+		}
+	}
 }
 
+// GetReconcileReply is the reply from ReconcileBlocks
 type GetReconcileReply struct {
-	Height    []uint64 `json:"height"`    // Height of block
+	JobID      ids.ID   `json:"jobID"`      // Reconcile job that checked the blocks
+	Height     []uint64 `json:"height"`     // Height of block
+	Superseded []uint64 `json:"superseded"` // Heights of Height already corrected by a later block
+}
+
+// ReconcileBlocks compares every attested Zcash block with zcashd. It runs a
+// reconcile job over the default range, or joins the one already running
+// over it, and waits for it. A client that gives up leaves the job running
+// in the background, the error names it so that its progress can be polled
+// with GetReconcileJob.
+func (s *Service) ReconcileBlocks(r *http.Request, _ *QueryDataArgs, reply *GetReconcileReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	job, err := s.vm.startReconcileJob(0, 0, 0)
+	s.vm.snowCtx.Lock.Unlock()
+	if errors.Is(err, errInvalidRange) {
+		// no attested Zcash block is old enough to check
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	job, err = s.vm.waitReconcileJob(r.Context(), job.ID)
+	if err != nil {
+		return err
+	}
+	if job.Status != ReconcileCompleted {
+		log.Warn("Failed to reconcile blocks", "job", job.ID, "status", job.Status, "err", job.Error)
+		return fmt.Errorf("%w: %s is %s: %s", errJobNotCompleted, job.ID, job.Status, job.Error)
+	}
+	reply.JobID = job.ID
+	reply.Height = job.Mismatched
+	reply.Superseded = job.Superseded
+	return nil
+}
+
+// StartReconcileArgs are the arguments to StartReconcile
+type StartReconcileArgs struct {
+	// Start and End are the inclusive range of Zcash heights to check. Start
+	// defaults to the first height above blockConfirmHeight, End to the
+	// highest attested height.
+	Start json.Uint64 `json:"start"`
+	End   json.Uint64 `json:"end"`
+	// Workers is the number of Zcash heights checked in parallel
+	Workers json.Uint32 `json:"workers"`
 }
 
-func (s *Service) ReconcileBlocks(_ *http.Request, args *QueryDataArgs, reply *GetReconcileReply) error {
-		
-	misMatchedHeights, err := s.vm.reconcileBlocks()
+// ReconcileJobArgs identify a reconcile job
+type ReconcileJobArgs struct {
+	JobID ids.ID `json:"jobID"`
+}
+
+// ReconcileJobReply describes the progress of a reconcile job
+type ReconcileJobReply struct {
+	JobID      ids.ID      `json:"jobID"`
+	Status     string      `json:"status"`     // running, completed, cancelled or failed
+	Start      json.Uint64 `json:"start"`      // First checked Zcash height
+	End        json.Uint64 `json:"end"`        // Last checked Zcash height
+	Workers    json.Uint32 `json:"workers"`    // Zcash heights checked in parallel
+	Checkpoint json.Uint64 `json:"checkpoint"` // First Zcash height not checked yet
+	Checked    json.Uint64 `json:"checked"`    // Number of checked Zcash heights
+	Total      json.Uint64 `json:"total"`      // Number of Zcash heights to check
+	Mismatches json.Uint64 `json:"mismatches"` // Number of mismatches found so far
+	Error      string      `json:"error,omitempty"`
+	StartedAt  json.Uint64 `json:"startedAt"`
+	UpdatedAt  json.Uint64 `json:"updatedAt"`
+}
+
+func (r *ReconcileJobReply) set(job *ReconcileJob) {
+	r.JobID = job.ID
+	r.Status = job.Status
+	r.Start = json.Uint64(job.Start)
+	r.End = json.Uint64(job.End)
+	r.Workers = json.Uint32(job.Workers)
+	r.Checkpoint = json.Uint64(job.Checkpoint)
+	r.Checked = json.Uint64(job.Checkpoint - job.Start)
+	r.Total = json.Uint64(job.End - job.Start + 1)
+	r.Mismatches = json.Uint64(len(job.Mismatched))
+	r.Error = job.Error
+	r.StartedAt = json.Uint64(job.StartedAt)
+	r.UpdatedAt = json.Uint64(job.UpdatedAt)
+}
+
+// StartReconcile starts a background job comparing the attested Zcash
+// blocks with zcashd. Unlike ReconcileBlocks, it returns right away. If a
+// job over the same range is already running, it returns that job.
+func (s *Service) StartReconcile(_ *http.Request, args *StartReconcileArgs, reply *ReconcileJobReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	job, err := s.vm.startReconcileJob(uint64(args.Start), uint64(args.End), uint32(args.Workers))
 	if err != nil {
-		fmt.Printf("Error in finding reconcileBlock : %+v\n", err)
 		return err
 	}
+	reply.set(job)
+	return nil
+}
 
-	if misMatchedHeights != nil {
-        // Assuming misMatchedHeights is a slice of int or uint64
-        reply.Height = make([]uint64, len(misMatchedHeights))
-        for i, height := range misMatchedHeights {
-            reply.Height[i] = uint64(height) // convert height to uint64 if it's not already
-        }
-    }
-	
+// GetReconcileJob returns the progress of a reconcile job
+func (s *Service) GetReconcileJob(_ *http.Request, args *ReconcileJobArgs, reply *ReconcileJobReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	job, err := s.vm.state.GetReconcileJob(args.JobID)
+	if err != nil {
+		return err
+	}
+	reply.set(job)
 	return nil
 }
 
+// CancelReconcile stops a running reconcile job. Its report keeps the
+// mismatches found so far.
+func (s *Service) CancelReconcile(_ *http.Request, args *ReconcileJobArgs, reply *ReconcileJobReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
 
+	job, err := s.vm.cancelReconcileJob(args.JobID)
+	if err != nil {
+		return err
+	}
+	reply.set(job)
+	return nil
+}
+
+// GetReconcileReportReply is the reply from GetReconcileReport
+type GetReconcileReportReply struct {
+	JobID      ids.ID   `json:"jobID"`
+	Status     string   `json:"status"`
+	Height     []uint64 `json:"height"`     // Mismatched Zcash heights checked so far
+	Superseded []uint64 `json:"superseded"` // Heights of Height already corrected by a later block
+}
+
+// GetReconcileReport returns the mismatches found by a reconcile job
+func (s *Service) GetReconcileReport(_ *http.Request, args *ReconcileJobArgs, reply *GetReconcileReportReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	job, err := s.vm.state.GetReconcileJob(args.JobID)
+	if err != nil {
+		return err
+	}
+	reply.JobID = job.ID
+	reply.Status = job.Status
+	reply.JobID = job.ID
+	reply.Height = job.Mismatched
+	reply.Superseded = job.Superseded
+	return nil
+}
+
+// ReorgReply is a Zcash reorg that replaced an attested Zcash block
+type ReorgReply struct {
+	Height       json.Uint64 `json:"height"`       // Zcash height
+	Original     ids.ID      `json:"original"`     // Block attesting the replaced Zcash block
+	OriginalHash string      `json:"originalHash"` // Hash of the replaced Zcash block
+	Hash         string      `json:"hash"`         // Hash of the Zcash block now at Height
+	DetectedAt   json.Uint64 `json:"detectedAt"`   // Unix time of the detection
+	Superseded   bool        `json:"superseded"`   // Whether a correction was accepted
+	SupersededBy ids.ID      `json:"supersededBy"` // Block attesting the correction
+}
+
+// GetReorgsReply is the reply from GetReorgs
+type GetReorgsReply struct {
+	Reorgs []ReorgReply `json:"reorgs"`
+}
+
+// GetReorgs returns the Zcash reorgs that replaced attested Zcash blocks
+func (s *Service) GetReorgs(_ *http.Request, _ *struct{}, reply *GetReorgsReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	reorgs, err := s.vm.state.GetReorgs()
+	s.vm.snowCtx.Lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	reply.Reorgs = make([]ReorgReply, len(reorgs))
+	for i, reorg := range reorgs {
+		reply.Reorgs[i] = ReorgReply{
+			Height:       json.Uint64(reorg.Height),
+			Original:     reorg.Original,
+			OriginalHash: reorg.OriginalHash,
+			Hash:         reorg.Correction.Hash,
+			DetectedAt:   json.Uint64(reorg.DetectedAt),
+			Superseded:   reorg.SupersededBy != ids.Empty,
+			SupersededBy: reorg.SupersededBy,
+		}
+	}
+	return nil
+}
+
+// HeaderChainGapReply is an inclusive range of unattested Zcash heights
+type HeaderChainGapReply struct {
+	Start json.Uint64 `json:"start"`
+	End   json.Uint64 `json:"end"`
+}
+
+// GetHeaderChainGapsReply is the reply from GetHeaderChainGaps
+type GetHeaderChainGapsReply struct {
+	Lowest   json.Uint64           `json:"lowest"`   // Lowest attested Zcash height
+	Highest  json.Uint64           `json:"highest"`  // Highest attested Zcash height
+	Attested json.Uint64           `json:"attested"` // Number of attested Zcash heights
+	Gaps     []HeaderChainGapReply `json:"gaps"`     // Unattested ranges between lowest and highest
+	Breaks   []json.Uint64         `json:"breaks"`   // Heights not extending the attestation below them
+}
+
+// GetHeaderChainGaps reports the gaps and breaks in the Zcash header chain
+// formed by the accepted blocks
+func (s *Service) GetHeaderChainGaps(_ *http.Request, _ *struct{}, reply *GetHeaderChainGapsReply) error {
+	report, err := s.vm.headerChainGaps()
+	if err != nil {
+		return err
+	}
+
+	reply.Lowest = json.Uint64(report.Lowest)
+	reply.Highest = json.Uint64(report.Highest)
+	reply.Attested = json.Uint64(report.Attested)
+	reply.Gaps = make([]HeaderChainGapReply, len(report.Gaps))
+	for i, gap := range report.Gaps {
+		reply.Gaps[i] = HeaderChainGapReply{Start: json.Uint64(gap.Start), End: json.Uint64(gap.End)}
+	}
+	reply.Breaks = make([]json.Uint64, len(report.Breaks))
+	for i, height := range report.Breaks {
+		reply.Breaks[i] = json.Uint64(height)
+	}
+	return nil
+}
 
 func assignValues(reply *GetBlockReply, block *Block) {
 
 	// Fill out the response with the block's data
 	reply.Timestamp = json.Uint64(block.Timestamp().Unix())
 	data := block.Data()
-	if len(data) != 0 {
-		zblock := ZcashBlock{}
-		ej.Unmarshal(data, &zblock)
-		reply.Data = zblock
+	if len(data) != 0 && block.Hght != 0 {
+		payload, err := decodePayload(data)
+		var zblocks []*ZcashBlock
+		if err == nil {
+			zblocks = payload.ZcashBlocks()
+		}
+		if corrections, ok := payload.(*CorrectionPayload); ok {
+			reply.Supersedes = make([]ids.ID, len(corrections.Corrections))
+			for i, correction := range corrections.Corrections {
+				reply.Supersedes[i] = correction.Supersedes
+			}
+		}
+		if len(zblocks) > 0 {
+			reply.Data = *zblocks[0]
+		}
+		if len(zblocks) > 1 {
+			reply.Attestations = make([]ZcashBlock, len(zblocks))
+			for i, zblock := range zblocks {
+				reply.Attestations[i] = *zblock
+			}
+		}
 	}
 	reply.Height = json.Uint64(block.Hght)
 	reply.ID = block.ID()
 	reply.ParentID = block.Parent()
 }
 
+// RequestStatusArgs are the arguments to GetRequestStatus
+type RequestStatusArgs struct {
+	Height json.Uint64 `json:"height"` // Requested Zcash height
+}
+
+// GetRequestStatusReply is the reply from GetRequestStatus
+type GetRequestStatusReply struct {
+	Height    json.Uint64 `json:"height"`
+	State     string      `json:"state"`   // queued, building, verified, accepted, rejected or failed
+	BlockID   ids.ID      `json:"blockID"` // Block attesting the Zcash height, once built
+	Reason    string      `json:"reason,omitempty"`
+	CreatedAt json.Uint64 `json:"createdAt"`
+	UpdatedAt json.Uint64 `json:"updatedAt"`
+}
+
+// GetRequestStatus returns the status of the attestation requested for a
+// Zcash height through GetBlockByHeight. Heights attested or pending without
+// a tracked request are reported as accepted or queued.
+func (s *Service) GetRequestStatus(_ *http.Request, args *RequestStatusArgs, reply *GetRequestStatusReply) error {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	height := uint64(args.Height)
+	status, err := s.tracker.Status(height)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		blkID, err := s.vm.state.GetBlockIDByZcashHeight(height)
+		switch {
+		case err == nil:
+			status = &RequestStatus{Height: height, State: RequestAccepted, BlockID: blkID}
+		case err != database.ErrNotFound:
+			return err
+		case s.vm.mempool.Has(height):
+			status = &RequestStatus{Height: height, State: RequestQueued}
+		default:
+			return fmt.Errorf("%w: height %d", errUnknownRequest, height)
+		}
+	}
+
+	reply.Height = json.Uint64(status.Height)
+	reply.State = status.State
+	reply.BlockID = status.BlockID
+	reply.Reason = status.Reason
+	reply.CreatedAt = json.Uint64(status.CreatedAt)
+	reply.UpdatedAt = json.Uint64(status.UpdatedAt)
+	return nil
+}
+
+// GetBlocksByHeightsArgs are the arguments to GetBlocksByHeights
+type GetBlocksByHeightsArgs struct {
+	Heights []json.Uint64 `json:"heights"` // Zcash heights, at most maxQueryLimit
+}
+
+// GetBlocksReply is the reply from the batch and range queries
+type GetBlocksReply struct {
+	// One reply per attested Zcash height, with Data holding that height
+	// (GetBlocksByHeights, GetBlockRange) or per block (ListBlocks)
+	Blocks []GetBlockReply `json:"blocks"`
+	// Requested Zcash heights that aren't attested (GetBlocksByHeights)
+	Missing []json.Uint64 `json:"missing,omitempty"`
+	// Cursor of the next page, omitted on the last page (GetBlockRange,
+	// ListBlocks)
+	Next *json.Uint64 `json:"next,omitempty"`
+}
+
+// GetBlocksByHeights returns the blocks attesting the Zcash heights of
+// [args.Heights]. Unlike GetBlockByHeight, missing heights aren't requested.
+func (s *Service) GetBlocksByHeights(_ *http.Request, args *GetBlocksByHeightsArgs, reply *GetBlocksReply) error {
+	if len(args.Heights) > s.vm.config.MaxQueryLimit {
+		return fmt.Errorf("%w: %d, max %d", errTooManyHeights, len(args.Heights), s.vm.config.MaxQueryLimit)
+	}
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	reply.Blocks = []GetBlockReply{}
+	for _, height := range args.Heights {
+		block, err := s.vm.getBlockByHeight(uint64(height))
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			reply.Missing = append(reply.Missing, height)
+			continue
+		}
+		blockReply := GetBlockReply{}
+		assignZcashValues(&blockReply, block, uint64(height))
+		reply.Blocks = append(reply.Blocks, blockReply)
+	}
+	return nil
+}
+
+// GetBlockRangeArgs are the arguments to GetBlockRange
+type GetBlockRangeArgs struct {
+	Start json.Uint64 `json:"start"` // First Zcash height, or the cursor of the next page
+	End   json.Uint64 `json:"end"`   // Last Zcash height, defaults to the highest attested one
+	Limit json.Uint32 `json:"limit"` // Page size, defaults to and is capped at maxQueryLimit
+}
+
+// GetBlockRange returns a page of the blocks attesting the Zcash heights from
+// [args.Start] to [args.End], skipping the heights that aren't attested. The
+// next page starts at [reply.Next].
+func (s *Service) GetBlockRange(_ *http.Request, args *GetBlockRangeArgs, reply *GetBlocksReply) error {
+	end := uint64(args.End)
+	if end == 0 {
+		end = math.MaxUint64
+	}
+	if uint64(args.Start) > end {
+		return fmt.Errorf("%w: start %d is above end %d", errInvalidRange, args.Start, end)
+	}
+	limit := s.queryLimit(args.Limit)
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	// Fetch one more height to know if there is a next page
+	heights, blkIDs, err := s.vm.state.GetZcashRange(uint64(args.Start), end, limit+1)
+	if err != nil {
+		return err
+	}
+	if len(heights) > limit {
+		next := json.Uint64(heights[limit])
+		reply.Next = &next
+		heights, blkIDs = heights[:limit], blkIDs[:limit]
+	}
+
+	reply.Blocks = make([]GetBlockReply, len(heights))
+	for i, height := range heights {
+		block, err := s.vm.getBlock(blkIDs[i])
+		if err != nil {
+			return err
+		}
+		assignZcashValues(&reply.Blocks[i], block, height)
+	}
+	return nil
+}
+
+// ListBlocksArgs are the arguments to ListBlocks
+type ListBlocksArgs struct {
+	Cursor json.Uint64 `json:"cursor"` // First block height, or the cursor of the next page
+	Limit  json.Uint32 `json:"limit"`  // Page size, defaults to and is capped at maxQueryLimit
+}
+
+// ListBlocks returns a page of the accepted blocks by ascending height from
+// [args.Cursor]. The next page starts at [reply.Next].
+func (s *Service) ListBlocks(_ *http.Request, args *ListBlocksArgs, reply *GetBlocksReply) error {
+	limit := s.queryLimit(args.Limit)
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	if !s.vm.heightIndexed.Get() {
+		return ErrIndexIncomplete
+	}
+	lastAcceptedID, err := s.vm.state.GetLastAccepted()
+	if err != nil {
+		return errCannotGetLastAccepted
+	}
+	lastAccepted, err := s.vm.getBlock(lastAcceptedID)
+	if err != nil {
+		return err
+	}
+
+	reply.Blocks = []GetBlockReply{}
+	height := uint64(args.Cursor)
+	for ; height <= lastAccepted.Height() && len(reply.Blocks) < limit; height++ {
+		blkID, err := s.vm.state.GetBlockIDAtHeight(height)
+		if err != nil {
+			return err
+		}
+		block, err := s.vm.getBlock(blkID)
+		if err != nil {
+			return err
+		}
+		blockReply := GetBlockReply{}
+		assignValues(&blockReply, block)
+		reply.Blocks = append(reply.Blocks, blockReply)
+	}
+	if height <= lastAccepted.Height() {
+		next := json.Uint64(height)
+		reply.Next = &next
+	}
+	return nil
+}
+
+// queryLimit returns the page size of a query asking for [limit] blocks
+func (s *Service) queryLimit(limit json.Uint32) int {
+	if limit == 0 || int(limit) > s.vm.config.MaxQueryLimit {
+		return s.vm.config.MaxQueryLimit
+	}
+	return int(limit)
+}
+
+// GetBlockByZcashHashArgs are the arguments to GetBlockByZcashHash
+type GetBlockByZcashHashArgs struct {
+	Hash string `json:"hash"` // Hash of the Zcash block
+}
+
+// GetBlockByZcashHash returns the latest block attesting the Zcash block with
+// hash [args.Hash], with that Zcash block as its Data
+func (s *Service) GetBlockByZcashHash(_ *http.Request, args *GetBlockByZcashHashArgs, reply *GetBlockReply) error {
+	hash := strings.ToLower(args.Hash)
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	blkID, err := s.vm.state.GetBlockIDByZcashHash(hash)
+	if err == database.ErrNotFound {
+		return fmt.Errorf("%w: %s", errNoSuchZcashHash, args.Hash)
+	}
+	if err != nil {
+		return err
+	}
+	block, err := s.vm.getBlock(blkID)
+	if err != nil {
+		return err
+	}
+	assignMatchingValues(reply, block, func(zblock *ZcashBlock) bool {
+		return zblock.Hash == hash
+	})
+	return nil
+}
+
+// GetBlockByTxIDArgs are the arguments to GetBlockByTxID
+type GetBlockByTxIDArgs struct {
+	TxID string `json:"txID"` // ID of the Zcash transaction
+}
+
+// GetBlockByTxID returns the latest block attesting a Zcash block that
+// includes the transaction [args.TxID], with that Zcash block as its Data
+func (s *Service) GetBlockByTxID(_ *http.Request, args *GetBlockByTxIDArgs, reply *GetBlockReply) error {
+	txID := strings.ToLower(args.TxID)
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	blkID, err := s.vm.state.GetBlockIDByZcashTx(txID)
+	if err == database.ErrNotFound {
+		return fmt.Errorf("%w: %s", errNoSuchTx, args.TxID)
+	}
+	if err != nil {
+		return err
+	}
+	block, err := s.vm.getBlock(blkID)
+	if err != nil {
+		return err
+	}
+	assignMatchingValues(reply, block, func(zblock *ZcashBlock) bool {
+		return slices.Contains(zblock.Tx, txID)
+	})
+	return nil
+}
+
+// GetTxInclusionProofArgs are the arguments to GetTxInclusionProof
+type GetTxInclusionProofArgs struct {
+	TxID string `json:"txID"` // ID of the Zcash transaction
+}
+
+// GetTxInclusionProofReply is the reply from GetTxInclusionProof
+type GetTxInclusionProofReply struct {
+	TxID string `json:"txID"`
+	// Index of the transaction in its Zcash block
+	Index json.Uint32 `json:"index"`
+	// TxCount is the number of transactions of the Zcash block, which sets
+	// the length of Branch
+	TxCount json.Uint32 `json:"txCount"`
+	// Branch holds the sibling hashes from the transaction up to the root
+	Branch      []string    `json:"branch"`
+	MerkleRoot  string      `json:"merkleRoot"`
+	ZcashHeight json.Uint64 `json:"zcashHeight"`
+	ZcashHash   string      `json:"zcashHash"`
+	// BlockID and Height identify the block attesting the Merkle root
+	BlockID ids.ID      `json:"blockID"`
+	Height  json.Uint64 `json:"height"`
+}
+
+// GetTxInclusionProof returns the Merkle branch proving that the Zcash
+// transaction [args.TxID] is included in an attested Zcash block
+func (s *Service) GetTxInclusionProof(_ *http.Request, args *GetTxInclusionProofArgs, reply *GetTxInclusionProofReply) error {
+	txID := strings.ToLower(args.TxID)
+	if _, err := hexToHash(txID); err != nil {
+		return err
+	}
+
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	blkID, err := s.vm.state.GetBlockIDByZcashTx(txID)
+	if err == database.ErrNotFound {
+		return fmt.Errorf("%w: %s", errNoSuchTx, args.TxID)
+	}
+	if err != nil {
+		return err
+	}
+	block, err := s.vm.getBlock(blkID)
+	if err != nil {
+		return err
+	}
+	zblocks, err := decodeAttestations(block.Data())
+	if err != nil {
+		return err
+	}
+	for _, zblock := range zblocks {
+		index := slices.Index(zblock.Tx, txID)
+		if index < 0 {
+			continue
+		}
+		branch, root, err := MerkleBranch(zblock.Tx, index)
+		if err != nil {
+			return err
+		}
+		// The transaction list was attested along with the root, so they
+		// can only disagree if the Zcash node lied about both
+		if root != zblock.MerkleRoot {
+			return fmt.Errorf("%w: zcash block %d hashes to %s, attested %s", errMerkleRootMismatch, zblock.Height, root, zblock.MerkleRoot)
+		}
+		reply.TxID = txID
+		reply.Index = json.Uint32(index)
+		reply.TxCount = json.Uint32(len(zblock.Tx))
+		reply.Branch = branch
+		reply.MerkleRoot = root
+		reply.ZcashHeight = json.Uint64(zblock.Height)
+		reply.ZcashHash = zblock.Hash
+		reply.BlockID = block.ID()
+		reply.Height = json.Uint64(block.Height())
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errTxNotInBlock, args.TxID)
+}
+
+// GetStatusReply is the reply from GetStatus
+type GetStatusReply struct {
+	LastAcceptedID     ids.ID      `json:"lastAcceptedID"`
+	LastAcceptedHeight json.Uint64 `json:"lastAcceptedHeight"`
+	HighestZcashHeight json.Uint64 `json:"highestZcashHeight"`
+	// ZcashTip is omitted, and ZcashError set, if zcashd can't be reached
+	ZcashTip   *json.Uint64 `json:"zcashTip,omitempty"`
+	ZcashError string       `json:"zcashError,omitempty"`
+	// Lag is the number of Zcash blocks with ConfirmationDepth
+	// confirmations above HighestZcashHeight
+	Lag               json.Uint64 `json:"lag"`
+	ConfirmationDepth json.Uint64 `json:"confirmationDepth"`
+	MempoolSize       json.Uint32 `json:"mempoolSize"`
+	// InFlightRequests counts the requested attestations that are neither
+	// accepted nor dropped yet
+	InFlightRequests json.Uint32 `json:"inFlightRequests"`
+	Bootstrapped     bool        `json:"bootstrapped"`
+}
+
+// GetStatus returns how far the attestations are behind the Zcash tip, along
+// with the state of the node
+func (s *Service) GetStatus(r *http.Request, _ *struct{}, reply *GetStatusReply) error {
+	highest, err := s.readStatus(reply)
+	if err != nil {
+		return err
+	}
+
+	// zcashd is queried without holding the lock
+	tip, err := s.vm.fetchZcashTip(r.Context())
+	if err != nil {
+		reply.ZcashError = err.Error()
+		return nil
+	}
+	reply.ZcashTip = (*json.Uint64)(&tip)
+	reply.Lag = json.Uint64(s.vm.zcashLag(tip, highest))
+	return nil
+}
+
+// readStatus assigns the local state of the node to [reply] and returns the
+// highest attested Zcash height
+func (s *Service) readStatus(reply *GetStatusReply) (uint64, error) {
+	s.vm.snowCtx.Lock.Lock()
+	defer s.vm.snowCtx.Lock.Unlock()
+
+	lastAcceptedID, err := s.vm.state.GetLastAccepted()
+	if err != nil {
+		return 0, errCannotGetLastAccepted
+	}
+	lastAccepted, err := s.vm.getBlock(lastAcceptedID)
+	if err != nil {
+		return 0, err
+	}
+	highest, err := s.vm.state.GetHighestZcashHeight()
+	if err != nil {
+		return 0, err
+	}
+	reply.LastAcceptedID = lastAcceptedID
+	reply.LastAcceptedHeight = json.Uint64(lastAccepted.Height())
+	reply.HighestZcashHeight = json.Uint64(highest)
+	reply.ConfirmationDepth = json.Uint64(s.vm.config.BlockConfirmHeight)
+	reply.MempoolSize = json.Uint32(s.vm.mempool.Size())
+	reply.InFlightRequests = json.Uint32(s.tracker.InFlight())
+	reply.Bootstrapped = s.vm.bootstrapped.Get()
+	return highest, nil
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	avajson "github.com/ava-labs/avalanchego/utils/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockQueries(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVMWithConfig(t, map[string]interface{}{
+		"maxQueryLimit": 2,
+	})
+	require.NoError(err)
+	for _, height := range []uint64{30, 31, 33} {
+		acceptZcashBlock(t, vm, height)
+	}
+	// A single block attests 34 and 35
+	proposeZcashBlock(t, vm, 34)
+	proposeZcashBlock(t, vm, 35)
+	batch, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(batch.Verify(ctx))
+	require.NoError(batch.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, batch.ID()))
+
+	service := Service{vm: vm, tracker: vm.tracker}
+	zcashHeights := func(reply *GetBlocksReply) []int {
+		var heights []int
+		for _, block := range reply.Blocks {
+			heights = append(heights, block.Data.Height)
+		}
+		return heights
+	}
+
+	reply := GetBlocksReply{}
+	require.NoError(service.GetBlocksByHeights(nil, &GetBlocksByHeightsArgs{Heights: []avajson.Uint64{35, 32}}, &reply))
+	require.Equal([]int{35}, zcashHeights(&reply))
+	require.Equal(batch.ID(), reply.Blocks[0].ID)
+	require.Equal([]avajson.Uint64{32}, reply.Missing)
+	err = service.GetBlocksByHeights(nil, &GetBlocksByHeightsArgs{Heights: []avajson.Uint64{30, 31, 33}}, &reply)
+	require.ErrorIs(err, errTooManyHeights)
+
+	// The range skips the heights that aren't attested, page by page
+	var pages [][]int
+	args := &GetBlockRangeArgs{Start: 29, End: 34}
+	for {
+		reply := GetBlocksReply{}
+		require.NoError(service.GetBlockRange(nil, args, &reply))
+		pages = append(pages, zcashHeights(&reply))
+		if reply.Next == nil {
+			break
+		}
+		args.Start = *reply.Next
+	}
+	require.Equal([][]int{{30, 31}, {33, 34}}, pages)
+
+	reply = GetBlocksReply{}
+	require.NoError(service.GetBlockRange(nil, &GetBlockRangeArgs{Start: 34, Limit: 1}, &reply))
+	require.Equal([]int{34}, zcashHeights(&reply))
+	require.Equal(avajson.Uint64(35), *reply.Next)
+	err = service.GetBlockRange(nil, &GetBlockRangeArgs{Start: 35, End: 34}, &reply)
+	require.ErrorIs(err, errInvalidRange)
+
+	// Every accepted block is listed once, from genesis
+	var listed []ids.ID
+	listArgs := &ListBlocksArgs{}
+	for {
+		reply := GetBlocksReply{}
+		require.NoError(service.ListBlocks(nil, listArgs, &reply))
+		require.LessOrEqual(len(reply.Blocks), 2)
+		for i, block := range reply.Blocks {
+			require.Equal(uint64(listArgs.Cursor)+uint64(i), uint64(block.Height))
+			listed = append(listed, block.ID)
+		}
+		if reply.Next == nil {
+			break
+		}
+		listArgs.Cursor = *reply.Next
+	}
+	require.Len(listed, 5)
+	require.Equal(batch.ID(), listed[4])
+}
+
+func TestTxInclusionProof(t *testing.T) {
+	require := require.New(t)
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	src := vm.zcash.(*testZcashSource)
+	blk := acceptZcashBlock(t, vm, 3)
+	// Transactions that don't hash to the attested root can't be proven
+	slices.Reverse(src.blocks[2].Tx)
+	acceptZcashBlock(t, vm, 2)
+
+	service := Service{vm: vm, tracker: vm.tracker}
+	zblock := src.blocks[3]
+	for index, txID := range zblock.Tx {
+		reply := GetTxInclusionProofReply{}
+		require.NoError(service.GetTxInclusionProof(nil, &GetTxInclusionProofArgs{TxID: strings.ToUpper(txID)}, &reply))
+		require.Equal(txID, reply.TxID)
+		require.Equal(avajson.Uint32(index), reply.Index)
+		require.Equal(avajson.Uint32(len(zblock.Tx)), reply.TxCount)
+		require.Equal(zblock.MerkleRoot, reply.MerkleRoot)
+		require.Equal(avajson.Uint64(3), reply.ZcashHeight)
+		require.Equal(zblock.Hash, reply.ZcashHash)
+		require.Equal(blk.ID(), reply.BlockID)
+		require.Equal(avajson.Uint64(blk.Height()), reply.Height)
+
+		root, err := ComputeMerkleRoot(txID, uint32(reply.Index), uint32(reply.TxCount), reply.Branch)
+		require.NoError(err)
+		require.Equal(zblock.MerkleRoot, root)
+	}
+
+	reply := GetTxInclusionProofReply{}
+	err = service.GetTxInclusionProof(nil, &GetTxInclusionProofArgs{TxID: src.blocks[2].Tx[0]}, &reply)
+	require.ErrorIs(err, errMerkleRootMismatch)
+	err = service.GetTxInclusionProof(nil, &GetTxInclusionProofArgs{TxID: testZcashTxIDs(4)[0]}, &reply)
+	require.ErrorIs(err, errNoSuchTx)
+	err = service.GetTxInclusionProof(nil, &GetTxInclusionProofArgs{TxID: "00"}, &reply)
+	require.ErrorIs(err, errInvalidTxID)
+}
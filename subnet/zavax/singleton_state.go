@@ -7,11 +7,19 @@ import "github.com/ava-labs/avalanchego/database"
 
 const (
 	IsInitializedKey byte = iota
+	IsZcashIndexedKey
+	IsHeightIndexedKey
+	HighestZcashHeightKey
+	IsTxIndexedKey
 )
 
 var (
-	isInitializedKey                = []byte{IsInitializedKey}
-	_                SingletonState = (*singletonState)(nil)
+	isInitializedKey                     = []byte{IsInitializedKey}
+	isZcashIndexedKey                    = []byte{IsZcashIndexedKey}
+	isHeightIndexedKey                   = []byte{IsHeightIndexedKey}
+	highestZcashHeightKey                = []byte{HighestZcashHeightKey}
+	isTxIndexedKey                       = []byte{IsTxIndexedKey}
+	_                     SingletonState = (*singletonState)(nil)
 )
 
 // SingletonState is a thin wrapper around a database to provide, caching,
@@ -19,6 +27,14 @@ var (
 type SingletonState interface {
 	IsInitialized() (bool, error)
 	SetInitialized() error
+	IsZcashIndexed() (bool, error)
+	SetZcashIndexed() error
+	IsHeightIndexed() (bool, error)
+	SetHeightIndexed() error
+	GetHighestZcashHeight() (uint64, error)
+	SetHighestZcashHeight(height uint64) error
+	IsTxIndexed() (bool, error)
+	SetTxIndexed() error
 }
 
 type singletonState struct {
@@ -38,3 +54,41 @@ func (s *singletonState) IsInitialized() (bool, error) {
 func (s *singletonState) SetInitialized() error {
 	return s.singletonDB.Put(isInitializedKey, nil)
 }
+
+func (s *singletonState) IsZcashIndexed() (bool, error) {
+	return s.singletonDB.Has(isZcashIndexedKey)
+}
+
+func (s *singletonState) SetZcashIndexed() error {
+	return s.singletonDB.Put(isZcashIndexedKey, nil)
+}
+
+func (s *singletonState) IsHeightIndexed() (bool, error) {
+	return s.singletonDB.Has(isHeightIndexedKey)
+}
+
+func (s *singletonState) SetHeightIndexed() error {
+	return s.singletonDB.Put(isHeightIndexedKey, nil)
+}
+
+// GetHighestZcashHeight returns the highest attested Zcash height, 0 if no
+// Zcash block is attested
+func (s *singletonState) GetHighestZcashHeight() (uint64, error) {
+	height, err := database.GetUInt64(s.singletonDB, highestZcashHeightKey)
+	if err == database.ErrNotFound {
+		return 0, nil
+	}
+	return height, err
+}
+
+func (s *singletonState) SetHighestZcashHeight(height uint64) error {
+	return database.PutUInt64(s.singletonDB, highestZcashHeightKey, height)
+}
+
+func (s *singletonState) IsTxIndexed() (bool, error) {
+	return s.singletonDB.Has(isTxIndexedKey)
+}
+
+func (s *singletonState) SetTxIndexed() error {
+	return s.singletonDB.Put(isTxIndexedKey, nil)
+}
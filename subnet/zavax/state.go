@@ -14,6 +14,14 @@ var (
 	// It's important to set different prefixes for each separate database objects.
 	singletonStatePrefix = []byte("singleton")
 	blockStatePrefix     = []byte("block")
+	heightIndexPrefix    = []byte("height")
+	zcashHeightPrefix    = []byte("zcashHeight")
+	zcashHashPrefix      = []byte("zcashHash")
+	zcashTxPrefix        = []byte("zcashTx")
+	mempoolPrefix        = []byte("mempool")
+	reorgPrefix          = []byte("reorg")
+	reconcilePrefix      = []byte("reconcile")
+	requestPrefix        = []byte("request")
 
 	_ State = &state{}
 )
@@ -25,6 +33,11 @@ type State interface {
 	// it is used to understand if db is initialized already.
 	SingletonState
 	BlockState
+	ZcashIndex
+	MempoolState
+	ReorgState
+	ReconcileState
+	RequestState
 
 	Commit() error
 	Close() error
@@ -33,6 +46,11 @@ type State interface {
 type state struct {
 	SingletonState
 	BlockState
+	ZcashIndex
+	MempoolState
+	ReorgState
+	ReconcileState
+	RequestState
 
 	baseDB *versiondb.Database
 }
@@ -43,13 +61,32 @@ func NewState(db database.Database, vm *VM) State {
 
 	// create a prefixed "blockDB" from baseDB
 	blockDB := prefixdb.New(blockStatePrefix, baseDB)
+	// create a prefixed "heightDB" indexing accepted blocks by height
+	heightDB := prefixdb.New(heightIndexPrefix, baseDB)
 	// create a prefixed "singletonDB" from baseDB
 	singletonDB := prefixdb.New(singletonStatePrefix, baseDB)
+	// create the prefixed databases of the Zcash index
+	zcashHeightDB := prefixdb.New(zcashHeightPrefix, baseDB)
+	zcashHashDB := prefixdb.New(zcashHashPrefix, baseDB)
+	zcashTxDB := prefixdb.New(zcashTxPrefix, baseDB)
+	// create a prefixed "mempoolDB" holding the pending Zcash blocks
+	mempoolDB := prefixdb.New(mempoolPrefix, baseDB)
+	// create a prefixed "reorgDB" holding the detected Zcash reorgs
+	reorgDB := prefixdb.New(reorgPrefix, baseDB)
+	// create a prefixed "reconcileDB" holding the reconcile jobs
+	reconcileDB := prefixdb.New(reconcilePrefix, baseDB)
+	// create a prefixed "requestDB" holding the status of the API requests
+	requestDB := prefixdb.New(requestPrefix, baseDB)
 
 	// return state with created sub state components
 	return &state{
-		BlockState:     NewBlockState(blockDB, vm),
+		BlockState:     NewBlockState(blockDB, heightDB, vm),
 		SingletonState: NewSingletonState(singletonDB),
+		ZcashIndex:     NewZcashIndex(zcashHeightDB, zcashHashDB, zcashTxDB),
+		MempoolState:   NewMempoolState(mempoolDB),
+		ReorgState:     NewReorgState(reorgDB),
+		ReconcileState: NewReconcileState(reconcileDB),
+		RequestState:   NewRequestState(requestDB),
 		baseDB:         baseDB,
 	}
 }
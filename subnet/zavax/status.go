@@ -0,0 +1,146 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// delay between two fetches of the Zcash tip for the health check
+const zcashTipPollInterval = 10 * time.Second
+
+var (
+	errZcashUnreachable = errors.New("zcashd is unreachable")
+	errZcashLag         = errors.New("attestations lag behind the zcash tip")
+	errZcashTipPending  = errors.New("zcash tip wasn't fetched yet")
+)
+
+// zcashTipCache holds the latest result of fetching the Zcash tip in the
+// background, so that the health check never waits on zcashd
+type zcashTipCache struct {
+	lock sync.RWMutex
+	tip  uint64
+	err  error
+}
+
+func newZcashTipCache() *zcashTipCache {
+	return &zcashTipCache{err: errZcashTipPending}
+}
+
+// Get returns the latest Zcash tip, or the error fetching it
+func (c *zcashTipCache) Get() (uint64, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.tip, c.err
+}
+
+// Set records the result of fetching the Zcash tip
+func (c *zcashTipCache) Set(tip uint64, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.tip, c.err = tip, err
+}
+
+// HealthReply is the VM's part of the node health report
+type HealthReply struct {
+	HighestZcashHeight uint64 `json:"highestZcashHeight"`
+	ZcashTip           uint64 `json:"zcashTip,omitempty"`
+	Lag                uint64 `json:"lag"`
+	MaxLag             uint64 `json:"maxLag"`
+}
+
+// zcashLag returns the number of Zcash blocks up to [tip] that have the
+// confirmations to be attested, but are above the highest attested height
+// [highest]
+func (vm *VM) zcashLag(tip uint64, highest uint64) uint64 {
+	confirmations := uint64(vm.config.BlockConfirmHeight)
+	if tip < confirmations || tip-confirmations <= highest {
+		return 0
+	}
+	return tip - confirmations - highest
+}
+
+// fetchZcashTip returns the current Zcash tip, giving up after a single
+// request timeout rather than retrying
+func (vm *VM) fetchZcashTip(ctx context.Context) (uint64, error) {
+	if timeout := vm.config.RequestTimeout.Duration; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	tip, err := vm.zcash.GetBlockCount(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errZcashUnreachable, err)
+	}
+	return tip, nil
+}
+
+// pollZcashTip fetches the Zcash tip every zcashTipPollInterval for the
+// health check, until the VM shuts down
+func (vm *VM) pollZcashTip() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-vm.shutdownChan
+		cancel()
+	}()
+
+	ticker := time.NewTicker(zcashTipPollInterval)
+	defer ticker.Stop()
+	for {
+		vm.pollZcashTipOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollZcashTipOnce fetches the Zcash tip into the cache the health check
+// reads
+func (vm *VM) pollZcashTipOnce(ctx context.Context) {
+	tip, err := vm.fetchZcashTip(ctx)
+	if ctx.Err() != nil {
+		// shutting down, which says nothing about zcashd
+		return
+	}
+	if err != nil {
+		log.Debug("Failed to fetch zcash tip", "err", err)
+	}
+	vm.zcashTip.Set(tip, err)
+}
+
+// HealthCheck implements the common.VM interface. The node is unhealthy when
+// zcashd can't be reached, or when MaxZcashLag is set and the attestations lag
+// further behind the Zcash tip. It is called with the context lock held, so
+// it reads the tip last fetched by pollZcashTip rather than querying zcashd.
+func (vm *VM) HealthCheck(context.Context) (interface{}, error) {
+	highest, err := vm.state.GetHighestZcashHeight()
+	if err != nil {
+		return nil, err
+	}
+	reply := &HealthReply{
+		HighestZcashHeight: highest,
+		MaxLag:             vm.config.MaxZcashLag,
+	}
+	tip, err := vm.zcashTip.Get()
+	if err != nil {
+		return reply, err
+	}
+	reply.ZcashTip = tip
+	reply.Lag = vm.zcashLag(tip, highest)
+	if vm.config.MaxZcashLag > 0 && reply.Lag > vm.config.MaxZcashLag {
+		return reply, fmt.Errorf("%w: %d zcash blocks behind, max %d", errZcashLag, reply.Lag, vm.config.MaxZcashLag)
+	}
+	return reply, nil
+}
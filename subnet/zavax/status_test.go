@@ -0,0 +1,80 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	avajson "github.com/ava-labs/avalanchego/utils/json"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableZcashSource fails to fetch the Zcash tip
+type unreachableZcashSource struct {
+	*testZcashSource
+}
+
+func (unreachableZcashSource) GetBlockCount(context.Context) (uint64, error) {
+	return 0, errZcashEmptyResult
+}
+
+func TestStatus(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVMWithConfig(t, map[string]interface{}{
+		"blockConfirmHeight": 10,
+		"maxZcashLag":        50,
+	})
+	require.NoError(err)
+	blk := acceptZcashBlock(t, vm, 30)
+	service := Service{vm: vm, tracker: vm.tracker}
+	request := httptest.NewRequest("POST", "/", nil)
+	require.NoError(service.GetBlockByHeight(request, &QueryDataArgs{ID: 40}, &GetBlockReply{}))
+
+	reply := GetStatusReply{}
+	require.NoError(service.GetStatus(request, nil, &reply))
+	require.Equal(blk.ID(), reply.LastAcceptedID)
+	require.Equal(avajson.Uint64(blk.Height()), reply.LastAcceptedHeight)
+	require.Equal(avajson.Uint64(30), reply.HighestZcashHeight)
+	require.Equal(avajson.Uint64(testZcashTip), *reply.ZcashTip)
+	require.Empty(reply.ZcashError)
+	// Zcash heights 31 to 90 have 10 confirmations
+	require.Equal(avajson.Uint64(60), reply.Lag)
+	require.Equal(avajson.Uint64(10), reply.ConfirmationDepth)
+	require.Equal(avajson.Uint32(1), reply.MempoolSize)
+	require.Equal(avajson.Uint32(1), reply.InFlightRequests)
+	require.False(reply.Bootstrapped)
+
+	// The health check only reads the tip fetched in the background
+	_, err = vm.HealthCheck(ctx)
+	require.ErrorIs(err, errZcashTipPending)
+	vm.pollZcashTipOnce(ctx)
+	health, err := vm.HealthCheck(ctx)
+	require.ErrorIs(err, errZcashLag)
+	require.Equal(uint64(60), health.(*HealthReply).Lag)
+
+	vm.config.MaxZcashLag = 60
+	_, err = vm.HealthCheck(ctx)
+	require.NoError(err)
+	vm.config.MaxZcashLag = 0
+	acceptZcashBlock(t, vm, 90)
+	health, err = vm.HealthCheck(ctx)
+	require.NoError(err)
+	require.Zero(health.(*HealthReply).Lag)
+
+	vm.zcash = unreachableZcashSource{vm.zcash.(*testZcashSource)}
+	_, err = vm.HealthCheck(ctx)
+	require.NoError(err)
+	vm.pollZcashTipOnce(ctx)
+	_, err = vm.HealthCheck(ctx)
+	require.ErrorIs(err, errZcashUnreachable)
+	reply = GetStatusReply{}
+	require.NoError(service.GetStatus(request, nil, &reply))
+	require.Nil(reply.ZcashTip)
+	require.Contains(reply.ZcashError, errZcashUnreachable.Error())
+	require.Equal(avajson.Uint64(90), reply.HighestZcashHeight)
+}
@@ -1,74 +1,315 @@
-// tracker.go
-package zavax
-
-import ( 
-	"sync" 
-	"fmt"
-	"time"
-)
-
-// RequestTracker represents the state of processing requests.
-type RequestTracker struct {
-    mutex               sync.Mutex
-    processingRequests map[uint64]chan struct{}
-	lastResetTime     time.Time
-}
-
-// NewRequestTracker creates a new RequestTracker.
-func NewRequestTracker() *RequestTracker {
-	fmt.Printf("Tracker initialized\n")
-    return &RequestTracker{
-        processingRequests: make(map[uint64]chan struct{}),
-		lastResetTime:     time.Now(),
-    
-    }
-}
-
-func (rt *RequestTracker) shouldReset() bool {
-    rt.mutex.Lock()
-    defer rt.mutex.Unlock()
-
-    return time.Since(rt.lastResetTime) >= 24*time.Hour
-}
-
-func (rt *RequestTracker) resetProcessingRequests() {
-    rt.mutex.Lock()
-    defer rt.mutex.Unlock()
-
-    // Reset the processingRequests map
-    rt.processingRequests = make(map[uint64]chan struct{})
-    // Update the last reset time
-    rt.lastResetTime = time.Now()
-}
-
-// MarkProcessing marks the request ID as currently being processed.
-func (rt *RequestTracker) MarkProcessing(id uint64) {
-	rt.mutex.Lock()
-	defer rt.mutex.Unlock()
-
-	fmt.Printf("Set mark processing\n")
-	// Create a channel to signal completion
-	done := make(chan struct{})
-	rt.processingRequests[id] = done
-	fmt.Printf("Set mark processing %v %d\n",rt.processingRequests[id], id)
-}
-
-// MarkProcessing marks the request ID as currently being processed.
-func (rt *RequestTracker) IsProcessing(id uint64) chan struct{} {
-	rt.mutex.Lock()
-	defer rt.mutex.Unlock()
-
-	fmt.Printf("check is processing %v %d\n", rt.processingRequests[id], id)
-	return rt.processingRequests[id]
-}
-
-// CompleteProcessing marks the request ID as completed and removes it from the processing set.
-func (rt *RequestTracker) CompleteProcessing(id uint64) {
-	if rt.shouldReset() {
-        rt.resetProcessingRequests()
-    }
-
-	rt.mutex.Lock()
-	defer rt.mutex.Unlock()
-
-}
\ No newline at end of file
+// tracker.go
+package zavax
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+
+	log "github.com/inconshreveable/log15"
+)
+
+// States of an attestation request
+const (
+	// RequestQueued is waiting in the mempool to be built into a block. A
+	// request this node couldn't verify is queued again with the reason.
+	RequestQueued = "queued"
+	// RequestBuilding was built into a block by this node
+	RequestBuilding = "building"
+	// RequestVerified is attested by a block that passed verification
+	RequestVerified = "verified"
+	// RequestAccepted is attested by an accepted block
+	RequestAccepted = "accepted"
+	// RequestRejected was attested by a rejected block, it is built again
+	RequestRejected = "rejected"
+	// RequestFailed failed verification and was dropped
+	RequestFailed = "failed"
+)
+
+// requestPruneInterval is the minimum delay between two removals of the
+// expired request statuses
+const requestPruneInterval = time.Hour
+
+var (
+	errUnknownRequest = errors.New("no attestation was requested for this zcash height")
+
+	_ RequestState = &requestState{}
+)
+
+// RequestStatus is the state of the attestation requested for a Zcash height
+type RequestStatus struct {
+	Height uint64 `serialize:"true" json:"height"`
+	State  string `serialize:"true" json:"state"`
+	// BlockID is the block attesting Height, once it's built or verified
+	BlockID ids.ID `serialize:"true" json:"blockID"`
+	// Reason is why the request failed or was queued again
+	Reason    string `serialize:"true" json:"reason"`
+	CreatedAt int64  `serialize:"true" json:"createdAt"`
+	UpdatedAt int64  `serialize:"true" json:"updatedAt"`
+}
+
+// final returns true if the status of the request can't change anymore
+func (s *RequestStatus) final() bool {
+	return s.State == RequestAccepted || s.State == RequestFailed
+}
+
+// RequestState persists the request statuses, keyed by Zcash height
+type RequestState interface {
+	GetRequestStatuses() ([]*RequestStatus, error)
+	// GetRequestStatus returns nil if no attestation of [height] was
+	// requested
+	GetRequestStatus(height uint64) (*RequestStatus, error)
+	PutRequestStatus(status *RequestStatus) error
+	DeleteRequestStatus(height uint64) error
+}
+
+type requestState struct {
+	// Zcash height --> RequestStatus
+	requestDB database.Database
+}
+
+// NewRequestState returns RequestState with the given db
+func NewRequestState(db database.Database) RequestState {
+	return &requestState{
+		requestDB: db,
+	}
+}
+
+func (s *requestState) GetRequestStatuses() ([]*RequestStatus, error) {
+	it := s.requestDB.NewIterator()
+	defer it.Release()
+
+	var statuses []*RequestStatus
+	for it.Next() {
+		status := &RequestStatus{}
+		if _, err := Codec.Unmarshal(it.Value(), status); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, it.Error()
+}
+
+func (s *requestState) GetRequestStatus(height uint64) (*RequestStatus, error) {
+	bytes, err := s.requestDB.Get(heightKey(height))
+	if err == database.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status := &RequestStatus{}
+	if _, err := Codec.Unmarshal(bytes, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *requestState) PutRequestStatus(status *RequestStatus) error {
+	bytes, err := Codec.Marshal(CodecVersion, status)
+	if err != nil {
+		return err
+	}
+	return s.requestDB.Put(heightKey(status.Height), bytes)
+}
+
+func (s *requestState) DeleteRequestStatus(height uint64) error {
+	return s.requestDB.Delete(heightKey(height))
+}
+
+// RequestTracker records the lifecycle of the attestations requested through
+// the API, from the mempool to the accepted block. Statuses expire [ttl]
+// after their last update. It must be used with the snow context lock held,
+// and its updates are persisted on the next commit of the state.
+type RequestTracker struct {
+	state      RequestState
+	ttl        time.Duration
+	lastPruned time.Time
+	// Zcash height --> last update of the requests that are neither
+	// attested nor dropped, so that counting them doesn't read every status
+	inFlight map[uint64]int64
+}
+
+// NewRequestTracker creates a new RequestTracker, indexing the requests in
+// [state] that are still in flight.
+func NewRequestTracker(state RequestState, ttl time.Duration) (*RequestTracker, error) {
+	statuses, err := state.GetRequestStatuses()
+	if err != nil {
+		return nil, err
+	}
+	rt := &RequestTracker{
+		state:    state,
+		ttl:      ttl,
+		inFlight: make(map[uint64]int64),
+	}
+	for _, status := range statuses {
+		rt.index(status)
+	}
+	return rt, nil
+}
+
+// Status returns the status of the request for [height], or nil if there is
+// none or it expired
+func (rt *RequestTracker) Status(height uint64) (*RequestStatus, error) {
+	status, err := rt.state.GetRequestStatus(height)
+	if err != nil || status == nil || rt.expired(status.UpdatedAt, time.Now()) {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Queued records a new request for [height], replacing any earlier one
+func (rt *RequestTracker) Queued(height uint64) {
+	rt.prune()
+	now := time.Now().Unix()
+	status := &RequestStatus{
+		Height:    height,
+		State:     RequestQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := rt.state.PutRequestStatus(status); err != nil {
+		log.Error("Failed to record request", "height", height, "err", err)
+		return
+	}
+	rt.index(status)
+}
+
+// Building records that [heights] were built into the block [blkID]
+func (rt *RequestTracker) Building(blkID ids.ID, heights []uint64) {
+	rt.update(heights, func(status *RequestStatus) bool {
+		status.State = RequestBuilding
+		status.BlockID = blkID
+		status.Reason = ""
+		return true
+	})
+}
+
+// Verified records that the block [blkID] attesting [heights] passed
+// verification
+func (rt *RequestTracker) Verified(blkID ids.ID, heights []uint64) {
+	rt.update(heights, func(status *RequestStatus) bool {
+		status.State = RequestVerified
+		status.BlockID = blkID
+		status.Reason = ""
+		return true
+	})
+}
+
+// Accepted records that [heights] are attested by the accepted block [blkID]
+func (rt *RequestTracker) Accepted(blkID ids.ID, heights []uint64) {
+	rt.update(heights, func(status *RequestStatus) bool {
+		status.State = RequestAccepted
+		status.BlockID = blkID
+		status.Reason = ""
+		return true
+	})
+}
+
+// Rejected records that the block [blkID] attesting [heights] was rejected.
+// The requests that moved on to another block are left as they are.
+func (rt *RequestTracker) Rejected(blkID ids.ID, heights []uint64) {
+	rt.update(heights, func(status *RequestStatus) bool {
+		if status.BlockID != blkID {
+			return false
+		}
+		status.State = RequestRejected
+		status.Reason = "block rejected"
+		return true
+	})
+}
+
+// Requeued records that [heights] are waiting to be built again because of
+// [reason]
+func (rt *RequestTracker) Requeued(heights []uint64, reason error) {
+	rt.update(heights, func(status *RequestStatus) bool {
+		status.State = RequestQueued
+		status.Reason = reason.Error()
+		return true
+	})
+}
+
+// Failed records that [heights] were dropped because of [reason]
+func (rt *RequestTracker) Failed(heights []uint64, reason error) {
+	rt.update(heights, func(status *RequestStatus) bool {
+		status.State = RequestFailed
+		status.Reason = reason.Error()
+		return true
+	})
+}
+
+// update applies [transition] to the pending requests for [heights], and
+// saves the ones it returns true for
+func (rt *RequestTracker) update(heights []uint64, transition func(*RequestStatus) bool) {
+	now := time.Now().Unix()
+	for _, height := range heights {
+		status, err := rt.Status(height)
+		if err != nil {
+			log.Error("Failed to read request", "height", height, "err", err)
+			continue
+		}
+		if status == nil || status.final() || !transition(status) {
+			continue
+		}
+		status.UpdatedAt = now
+		if err := rt.state.PutRequestStatus(status); err != nil {
+			log.Error("Failed to record request", "height", height, "state", status.State, "err", err)
+			continue
+		}
+		rt.index(status)
+	}
+}
+
+// index records whether [status] is in flight
+func (rt *RequestTracker) index(status *RequestStatus) {
+	if status.final() {
+		delete(rt.inFlight, status.Height)
+		return
+	}
+	rt.inFlight[status.Height] = status.UpdatedAt
+}
+
+// InFlight returns the number of requests that are neither attested nor
+// dropped yet
+func (rt *RequestTracker) InFlight() int {
+	now := time.Now()
+	count := 0
+	for _, updatedAt := range rt.inFlight {
+		if !rt.expired(updatedAt, now) {
+			count++
+		}
+	}
+	return count
+}
+
+// expired returns true if a status last updated at [updatedAt] expired
+func (rt *RequestTracker) expired(updatedAt int64, now time.Time) bool {
+	return now.Sub(time.Unix(updatedAt, 0)) >= rt.ttl
+}
+
+// prune deletes the expired statuses, at most once per requestPruneInterval
+func (rt *RequestTracker) prune() {
+	now := time.Now()
+	if now.Sub(rt.lastPruned) < requestPruneInterval {
+		return
+	}
+	rt.lastPruned = now
+
+	statuses, err := rt.state.GetRequestStatuses()
+	if err != nil {
+		log.Error("Failed to read requests", "err", err)
+		return
+	}
+	for _, status := range statuses {
+		if !rt.expired(status.UpdatedAt, now) {
+			continue
+		}
+		if err := rt.state.DeleteRequestStatus(status.Height); err != nil {
+			log.Error("Failed to delete expired request", "height", status.Height, "err", err)
+			return
+		}
+		delete(rt.inFlight, status.Height)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/ava-labs/avalanchego/snow/engine/common"
+	"github.com/ava-labs/avalanchego/snow/snowtest"
+	avajson "github.com/ava-labs/avalanchego/utils/json"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestStatus(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	service := Service{vm: vm, tracker: vm.tracker}
+
+	requireState := func(service *Service, height uint64, state string, blkID ids.ID) *GetRequestStatusReply {
+		reply := &GetRequestStatusReply{}
+		require.NoError(service.GetRequestStatus(nil, &RequestStatusArgs{Height: avajson.Uint64(height)}, reply))
+		require.Equal(state, reply.State)
+		require.Equal(blkID, reply.BlockID)
+		return reply
+	}
+	request := func(height uint64) {
+		require.NoError(service.GetBlockByHeight(httptest.NewRequest("POST", "/", nil), &QueryDataArgs{ID: height}, &GetBlockReply{}))
+	}
+
+	// A request goes through every state until its block is accepted
+	request(40)
+	queued := requireState(&service, 40, RequestQueued, ids.Empty)
+	require.NotZero(queued.CreatedAt)
+	require.Equal(1, vm.tracker.InFlight())
+
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	requireState(&service, 40, RequestBuilding, blk.ID())
+	require.NoError(blk.Verify(ctx))
+	requireState(&service, 40, RequestVerified, blk.ID())
+	require.NoError(blk.Reject(ctx))
+	rejected := requireState(&service, 40, RequestRejected, blk.ID())
+	require.NotEmpty(rejected.Reason)
+
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	accepted := requireState(&service, 40, RequestAccepted, blk.ID())
+	require.Empty(accepted.Reason)
+	require.Zero(vm.tracker.InFlight())
+	require.Equal(queued.CreatedAt, accepted.CreatedAt)
+
+	// A request that fails verification keeps the reason
+	request(41)
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	forkZcashSource(vm, 41)
+	require.ErrorIs(blk.Verify(ctx), errBlockNotMatch)
+	failed := requireState(&service, 41, RequestFailed, blk.ID())
+	require.Contains(failed.Reason, errBlockNotMatch.Error())
+
+	// A request this node couldn't verify is queued again with the reason
+	request(42)
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	src := vm.zcash.(*testZcashSource)
+	tip := src.tip
+	src.tip = 42
+	require.ErrorIs(blk.Verify(ctx), errBlockHeightNotAllowed)
+	requeued := requireState(&service, 42, RequestQueued, blk.ID())
+	require.Contains(requeued.Reason, errBlockHeightNotAllowed.Error())
+	src.tip = tip
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	requireState(&service, 42, RequestAccepted, blk.ID())
+
+	// Heights that weren't requested through the API are reported from the
+	// zcash index
+	attested := acceptZcashBlock(t, vm, 30)
+	requireState(&service, 30, RequestAccepted, attested.ID())
+	err = service.GetRequestStatus(nil, &RequestStatusArgs{Height: 50}, &GetRequestStatusReply{})
+	require.ErrorIs(err, errUnknownRequest)
+
+	// The statuses are persisted
+	request(43)
+	require.Equal(1, vm.tracker.InFlight())
+	require.NoError(vm.Shutdown(ctx))
+	config := vm.config
+	config.RequestStatusTTL = Duration{1}
+	restart := func(config Config) *VM {
+		restarted := &VM{zcash: vm.zcash, equihashN: vm.equihashN, equihashK: vm.equihashK}
+		configBytes, err := json.Marshal(config)
+		require.NoError(err)
+		require.NoError(restarted.Initialize(ctx, snowtest.Context(t, blockchainID), vm.dbManager, []byte{0, 0, 0, 0, 0}, nil, configBytes, make(chan common.Message, 1), nil, nil))
+		return restarted
+	}
+	restarted := restart(vm.config)
+	requireState(&Service{vm: restarted, tracker: restarted.tracker}, 41, RequestFailed, failed.BlockID)
+	require.Equal(1, restarted.tracker.InFlight())
+	require.NoError(restarted.Shutdown(ctx))
+
+	// and expire after the ttl
+	restarted = restart(config)
+	service = Service{vm: restarted, tracker: restarted.tracker}
+	err = service.GetRequestStatus(nil, &RequestStatusArgs{Height: 41}, &GetRequestStatusReply{})
+	require.ErrorIs(err, errUnknownRequest)
+	require.Zero(restarted.tracker.InFlight())
+	restarted.tracker.Queued(42)
+	status, err := restarted.state.GetRequestStatus(41)
+	require.NoError(err)
+	require.Nil(status)
+	require.NotContains(restarted.tracker.inFlight, uint64(43))
+	require.NoError(restarted.Shutdown(ctx))
+}
@@ -7,11 +7,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gorilla/rpc/v2"
 	log "github.com/inconshreveable/log15"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 
 	ejson "encoding/json"
@@ -32,11 +35,23 @@ const (
 	DataLen        = 32
 	Name           = "zavax"
 	MaxMempoolSize = 4096
+
+	// number of blocks indexed per lock acquisition while backfilling the
+	// height index
+	heightIndexBatchSize = 1024
+	// number of attested Zcash heights read per lock acquisition while
+	// reporting the header chain gaps
+	headerChainPageSize = 1024
 )
 
 var (
-	errNoPendingBlocks = errors.New("there is no block to propose")
-	errBadGenesisBytes = errors.New("genesis data should be bytes (max length 32)")
+	errNoPendingBlocks   = errors.New("there is no block to propose")
+	errBadGenesisBytes   = errors.New("genesis data should be bytes (max length 32)")
+	errBrokenHeaderChain = errors.New("zcash block does not extend the attested block at the previous height")
+	// ErrIndexIncomplete is returned by VerifyHeightIndex while the height
+	// index is being backfilled. It mirrors the error of the same name
+	// removed from avalanchego's block package.
+	ErrIndexIncomplete = errors.New("query failed because height index is incomplete")
 	Version            = &version.Semantic{
 		Major: 1,
 		Minor: 3,
@@ -64,8 +79,8 @@ type VM struct {
 	// channel to send messages to the consensus engine
 	toEngine chan<- common.Message
 
-	// Proposed pieces of data that haven't been put into a block and proposed yet
-	mempool [][]byte
+	// Zcash blocks that haven't been attested yet
+	mempool *mempool
 
 	// Block ID --> Block
 	// Each element is a block that passed verification but
@@ -75,17 +90,49 @@ type VM struct {
 	// Indicates that this VM has finised bootstrapping for the chain
 	bootstrapped utils.Atomic[bool]
 
-	// Set to track unique data using string representation
-	mempoolSet map[string]bool
+	// Indicates that every accepted block is in the height index
+	heightIndexed utils.Atomic[bool]
+
+	// closed on shutdown to stop background goroutines
+	shutdownChan chan struct{}
+
+	// Source of Zcash chain data, defaults to the zcashd at config.Url
+	zcash ZcashSource
+
+	// Equihash parameters of the attested Zcash headers, EquihashN and
+	// EquihashK unless set before Initialize by the tests of a regtest chain
+	equihashN, equihashK int
+
+	// latest Zcash tip, fetched in the background for the health check
+	zcashTip *zcashTipCache
+
+	// job ID --> reconcile job running in the background
+	reconcileJobs map[ids.ID]*reconcileRun
+
+	// callers waiting on the attestation of Zcash heights
+	waiters *attestationWaiters
+
+	// status of the attestations requested through the API
+	tracker *RequestTracker
+
+	// WebSocket feed of the accepted blocks
+	feed *blockFeed
+
+	metrics *metrics
 }
 
-// GetBlockIDAtHeight implements block.ChainVM.
+// GetBlockIDAtHeight implements block.ChainVM. It returns
+// database.ErrNotFound for heights that aren't indexed (yet).
 func (vm *VM) GetBlockIDAtHeight(ctx context.Context, height uint64) (ids.ID, error) {
 	return vm.state.GetBlockIDAtHeight(height)
 }
 
-// VerifyHeightIndex implements block.ChainVM.
-func (*VM) VerifyHeightIndex(context.Context) error {
+// VerifyHeightIndex returns ErrIndexIncomplete until the height index has
+// been backfilled
+func (vm *VM) VerifyHeightIndex(context.Context) error {
+	if !vm.heightIndexed.Get() {
+		return ErrIndexIncomplete
+	}
 	return nil
 }
 
@@ -124,26 +171,87 @@ func (vm *VM) Initialize(
 		}
 		log.Info("Override Default Config", "Zcash URL from config file", vm.config.Url)
 	}
+	if err := vm.config.Verify(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
 
 	vm.dbManager = dbManager
 	vm.snowCtx = snowCtx
 	vm.toEngine = toEngine
 	vm.verifiedBlocks = make(map[ids.ID]*Block)
+	vm.shutdownChan = make(chan struct{})
+	vm.waiters = newAttestationWaiters()
+	vm.feed = newBlockFeed()
+	vm.zcashTip = newZcashTipCache()
+
+	registry := prometheus.NewRegistry()
+	if err := snowCtx.Metrics.Register("", registry); err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+	vm.metrics, err = newMetrics(registry)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics: %w", err)
+	}
+
+	if vm.zcash == nil {
+		vm.zcash = newZcashSource(&vm.config, vm.metrics)
+	}
+	if vm.equihashN == 0 {
+		vm.equihashN, vm.equihashK = EquihashN, EquihashK
+	}
 
 	// Create new state
 	vm.state = NewState(vm.dbManager, vm)
+	vm.tracker, err = NewRequestTracker(vm.state, vm.config.RequestStatusTTL.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to load request statuses: %w", err)
+	}
+
+	// Reload the Zcash blocks that were pending before a restart
+	vm.mempool, err = newMempool(vm.state, vm.config.MaxMempoolSize, vm.metrics.mempoolSize)
+	if err != nil {
+		return fmt.Errorf("failed to load mempool: %w", err)
+	}
+	if vm.mempool.Len() > 0 {
+		log.Info("Reloaded mempool", "size", vm.mempool.Len())
+	}
 
 	// Initialize genesis
 	if err := vm.initGenesis(genesisData); err != nil {
 		return err
 	}
 
+	// Index the Zcash blocks attested before the index existed
+	if err := vm.initZcashIndex(); err != nil {
+		return err
+	}
+	if err := vm.initTxIndex(); err != nil {
+		return err
+	}
+
+	// Resume the reconcile jobs interrupted by a restart
+	vm.reconcileJobs = make(map[ids.ID]*reconcileRun)
+	if err := vm.resumeReconcileJobs(); err != nil {
+		return err
+	}
+
 	// Get last accepted
 	lastAccepted, err := vm.state.GetLastAccepted()
 	if err != nil {
 		return err
 	}
 
+	// Index the heights of the blocks accepted before the height index
+	// existed in the background
+	heightIndexed, err := vm.state.IsHeightIndexed()
+	if err != nil {
+		return err
+	}
+	vm.heightIndexed.Set(heightIndexed)
+	if !heightIndexed {
+		go vm.backfillHeightIndex(lastAccepted)
+	}
+
 	snowCtx.Log.Info("initializing last accepted block",
 		zap.Any("id", lastAccepted),
 	)
@@ -198,73 +306,345 @@ func (vm *VM) initGenesis(genesisData []byte) error {
 		return fmt.Errorf("error while setting db to initialized: %w", err)
 	}
 
+	// A new chain is indexed from its genesis block
+	if err := vm.state.SetZcashIndexed(); err != nil {
+		return err
+	}
+	if err := vm.state.SetTxIndexed(); err != nil {
+		return err
+	}
+	if err := vm.state.SetHeightIndexed(); err != nil {
+		return err
+	}
+
 	// Flush VM's database to underlying db
 	return vm.state.Commit()
 }
 
+// initZcashIndex indexes the Zcash blocks attested by the accepted blocks, if
+// this database predates the Zcash index
+func (vm *VM) initZcashIndex() error {
+	indexed, err := vm.state.IsZcashIndexed()
+	if err != nil {
+		return err
+	}
+	if indexed {
+		return nil
+	}
+
+	id, err := vm.state.GetLastAccepted()
+	if err != nil {
+		return err
+	}
+	log.Info("Rebuilding Zcash index", "lastAccepted", id)
+
+	// Walk from the last accepted block so that the latest attestation of a
+	// Zcash block wins
+	indexedHeights := make(map[int]struct{})
+	highest := 0
+	for {
+		blk, err := vm.getBlock(id)
+		if err != nil {
+			return err
+		}
+		if blk.Hght == 0 {
+			break
+		}
+		zblocks, err := decodeAttestations(blk.Data())
+		if err != nil {
+			return fmt.Errorf("couldn't decode block %s: %w", blk.ID(), err)
+		}
+		for _, zblock := range zblocks {
+			highest = max(highest, zblock.Height)
+			if _, ok := indexedHeights[zblock.Height]; ok {
+				continue
+			}
+			indexedHeights[zblock.Height] = struct{}{}
+			if err := vm.state.PutZcashBlock(zblock, blk.ID()); err != nil {
+				return err
+			}
+		}
+		id = blk.PrntID
+	}
+	log.Info("Rebuilt Zcash index", "heights", len(indexedHeights))
+
+	if err := vm.state.SetHighestZcashHeight(uint64(highest)); err != nil {
+		return err
+	}
+
+	if err := vm.state.SetZcashIndexed(); err != nil {
+		return err
+	}
+	return vm.state.Commit()
+}
+
+// initTxIndex indexes the transactions of the Zcash blocks attested by the
+// accepted blocks, if this database predates the transaction index
+func (vm *VM) initTxIndex() error {
+	indexed, err := vm.state.IsTxIndexed()
+	if err != nil {
+		return err
+	}
+	if indexed {
+		return nil
+	}
+
+	id, err := vm.state.GetLastAccepted()
+	if err != nil {
+		return err
+	}
+	log.Info("Rebuilding Zcash transaction index", "lastAccepted", id)
+
+	// Walk from the last accepted block so that the latest attestation of a
+	// transaction wins
+	indexedTxs := 0
+	for {
+		blk, err := vm.getBlock(id)
+		if err != nil {
+			return err
+		}
+		if blk.Hght == 0 {
+			break
+		}
+		zblocks, err := decodeAttestations(blk.Data())
+		if err != nil {
+			return fmt.Errorf("couldn't decode block %s: %w", blk.ID(), err)
+		}
+		for _, zblock := range zblocks {
+			unindexed := &ZcashBlock{}
+			for _, txID := range zblock.Tx {
+				_, err := vm.state.GetBlockIDByZcashTx(txID)
+				if err == database.ErrNotFound {
+					unindexed.Tx = append(unindexed.Tx, txID)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := vm.state.PutZcashTxs(unindexed, blk.ID()); err != nil {
+				return err
+			}
+			indexedTxs += len(unindexed.Tx)
+		}
+		id = blk.PrntID
+	}
+	log.Info("Rebuilt Zcash transaction index", "txs", indexedTxs)
+
+	if err := vm.state.SetTxIndexed(); err != nil {
+		return err
+	}
+	return vm.state.Commit()
+}
+
+// backfillHeightIndex indexes the height of every block from [lastAccepted]
+// down to the genesis block. Blocks accepted meanwhile are indexed by Accept.
+// The height index is marked complete once the genesis block is reached.
+func (vm *VM) backfillHeightIndex(lastAccepted ids.ID) {
+	log.Info("Backfilling height index", "lastAccepted", lastAccepted)
+	id := lastAccepted
+	for {
+		done, err := vm.backfillHeightIndexBatch(&id)
+		if err != nil {
+			log.Error("Failed to backfill height index", "err", err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// backfillHeightIndexBatch indexes up to heightIndexBatchSize blocks starting
+// at [id] and its ancestors, and advances [id] past them. It returns true
+// once the index is complete or the VM is shutting down.
+func (vm *VM) backfillHeightIndexBatch(id *ids.ID) (bool, error) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	if vm.isShuttingDown() {
+		return true, nil
+	}
+
+	for i := 0; i < heightIndexBatchSize; i++ {
+		blk, err := vm.state.GetBlock(*id)
+		if err != nil {
+			return false, err
+		}
+		if err := vm.state.PutBlockIDAtHeight(blk.Hght, blk.ID()); err != nil {
+			return false, err
+		}
+		if blk.Hght == 0 {
+			if err := vm.state.SetHeightIndexed(); err != nil {
+				return false, err
+			}
+			if err := vm.state.Commit(); err != nil {
+				return false, err
+			}
+			vm.heightIndexed.Set(true)
+			log.Info("Backfilled height index")
+			return true, nil
+		}
+		*id = blk.PrntID
+	}
+	return false, vm.state.Commit()
+}
+
 // CreateHandlers returns a map where:
-// Keys: The path extension for this VM's API (empty in this case)
+// Keys: The path extension for this VM's API: empty for the JSON-RPC
+// service, FeedEndpoint for the WebSocket feed and RESTRoutes for the REST API
 // Values: The handler for the API
 func (vm *VM) CreateHandlers(_ context.Context) (map[string]http.Handler, error) {
 	server := rpc.NewServer()
-	requestTracker := NewRequestTracker()
 	server.RegisterCodec(json.NewCodec(), "application/json")
 	server.RegisterCodec(json.NewCodec(), "application/json;charset=UTF-8")
-	if err := server.RegisterService(&Service{vm: vm, tracker: requestTracker}, Name); err != nil {
+	if err := server.RegisterService(&Service{vm: vm, tracker: vm.tracker}, Name); err != nil {
 		return nil, err
 	}
 
-	return map[string]http.Handler{
-		"": server,
-	}, nil
+	handlers := map[string]http.Handler{
+		"":           server,
+		FeedEndpoint: vm.feed,
+	}
+	rest := newRESTHandler(vm)
+	for _, route := range RESTRoutes {
+		handlers[route] = rest
+	}
+	return handlers, nil
 }
 
-// Health implements the common.VM interface
-func (*VM) HealthCheck(_ context.Context) (interface{}, error) { return nil, nil }
-
 // BuildBlock returns a block that this vm wants to add to consensus
 func (vm *VM) BuildBlock(ctx context.Context) (snowman.Block, error) {
-	fmt.Printf("BuildBlock : \n")
-	if len(vm.mempool) == 0 { // There is no block to be built
+	log.Debug("Building block", "preferred", vm.preferred)
+
+	// The engine verifies the blocks it issues right after building them, so
+	// the previously built blocks that weren't verified were abandoned
+	if heights := vm.mempool.Abandoned(func(blkID ids.ID) bool {
+		_, ok := vm.verifiedBlocks[blkID]
+		return ok
+	}); len(heights) > 0 {
+		log.Debug("Requeuing zcash blocks of abandoned blocks", "zcashHeights", heights)
+		vm.tracker.Requeued(heights, errBlockAbandoned)
+	}
+
+	// Zcash blocks attested by the preferred block and its processing
+	// ancestors
+	pending, err := vm.processingAttestations(vm.preferred)
+	if err != nil {
+		return nil, err
+	}
+
+	// Corrections of Zcash reorgs go first
+	corrections, err := vm.pendingCorrections(pending)
+	if err != nil {
+		return nil, err
+	}
+	if len(corrections) > 0 {
+		return vm.buildCorrectionBlock(corrections)
+	}
+
+	if vm.mempool.Len() == 0 { // There is no block to be built
 		return nil, errNoPendingBlocks
 	}
 
-	// Get the value to put in the new block
-	value := vm.mempool[0]
-	vm.mempool = vm.mempool[1:]
+	// Fill the block with as many pending Zcash blocks as the block limits
+	// allow
+	var (
+		attestations []Attestation
+		heights      []uint64
+		size         = emptyPayloadSize
+		// Zcash blocks attested earlier in this block by height
+		batch = make(map[int]*ZcashBlock)
+	)
+	for vm.mempool.Len() > 0 && len(attestations) < vm.config.MaxBlockAttestations {
+		height, value := vm.mempool.Peek()
+		zblock, err := decodeZcashBlock(value)
+		if err != nil {
+			return nil, err
+		}
+		attestation := newAttestation(zblock)
+		entrySize, err := attestationSize(&attestation)
+		if err != nil {
+			return nil, err
+		}
+		if len(attestations) > 0 && size+entrySize > vm.config.MaxBlockDataSize {
+			break
+		}
+		vm.mempool.Pop()
+
+		// Drop the Zcash blocks that are already attested
+		duplicate, err := vm.isDuplicateAttestation(zblock, pending)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate {
+			log.Debug("Dropping zcash block that is already attested", "zcashHeight", height)
+			vm.metrics.dedupeHits.WithLabelValues(dedupeBuild).Inc()
+			if err := vm.mempool.Remove(height); err != nil {
+				return nil, err
+			}
+			if err := vm.state.Commit(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Drop the Zcash blocks that don't extend the attestation below them
+		if err := vm.checkHeaderChain(zblock, batch); err != nil {
+			log.Debug("Dropping zcash block that breaks the header chain", "zcashHeight", height, "err", err)
+			if err := vm.mempool.Remove(height); err != nil {
+				return nil, err
+			}
+			vm.tracker.Failed([]uint64{height}, err)
+			vm.waiters.dropped([]uint64{height}, fmt.Errorf("%w: %v", errAttestationDropped, err))
+			if err := vm.state.Commit(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		pending.Add(zblock)
+		batch[zblock.Height] = zblock
+		attestations = append(attestations, attestation)
+		heights = append(heights, height)
+		size += entrySize
+	}
 
 	// Notify consensus engine that there are more pending data for blocks
 	// (if that is the case) when done building this block
-	if len(vm.mempool) > 0 {
+	if vm.mempool.Len() > 0 {
 		defer vm.NotifyBlockReady()
 	}
 
-	blockStr := blockToString(value)
-
-	if vm.mempoolSet == nil {
-		vm.mempoolSet = make(map[string]bool)
-	}
-
-	// Check if the block is already in the set
-	if _, exists := vm.mempoolSet[blockStr]; exists {
-		fmt.Printf("Duplicate block request \n")
+	if len(attestations) == 0 {
 		return nil, fmt.Errorf("Duplicate block request ")
 	}
 
-	//vm.mempoolSet[blockStr] = true
-
 	// Gets Preferred Block
 	preferredBlock, err := vm.getBlock(vm.preferred)
 	if err != nil {
+		vm.mempool.Requeue(heights)
 		return nil, fmt.Errorf("couldn't get preferred block: %w", err)
 	}
 	preferredHeight := preferredBlock.Height()
 
+	data, err := encodePayload(&AttestationPayload{Attestations: attestations})
+	if err != nil {
+		vm.mempool.Requeue(heights)
+		return nil, fmt.Errorf("couldn't encode attestations: %w", err)
+	}
+
 	// Build the block with preferred height
-	newBlock, err := vm.NewBlock(vm.preferred, preferredHeight+1, value, time.Now())
+	newBlock, err := vm.NewBlock(vm.preferred, preferredHeight+1, data, time.Now())
 	if err != nil {
+		vm.mempool.Requeue(heights)
 		return nil, fmt.Errorf("couldn't build block: %w", err)
 	}
+	vm.mempool.Built(newBlock.ID(), heights)
+	vm.tracker.Building(newBlock.ID(), heights)
+	vm.metrics.blocksBuilt.Inc()
+	if err := vm.state.Commit(); err != nil {
+		return nil, err
+	}
 
 	// Verifies block
 	//if err := newBlock.Verify(ctx); err != nil {
@@ -273,6 +653,44 @@ func (vm *VM) BuildBlock(ctx context.Context) (snowman.Block, error) {
 	return newBlock, nil
 }
 
+// buildCorrectionBlock returns a block attesting as many of [corrections] as
+// the block limits allow
+func (vm *VM) buildCorrectionBlock(corrections []Correction) (snowman.Block, error) {
+	pendingCount := len(corrections)
+	size := emptyPayloadSize
+	for i := range corrections {
+		entrySize, err := attestationSize(&corrections[i].Attestation)
+		if err != nil {
+			return nil, err
+		}
+		if i == vm.config.MaxBlockAttestations || (i > 0 && size+correctionSize+entrySize > vm.config.MaxBlockDataSize) {
+			corrections = corrections[:i]
+			break
+		}
+		size += correctionSize + entrySize
+	}
+
+	// The remaining corrections and the mempool are built into the next
+	// blocks
+	if len(corrections) < pendingCount || vm.mempool.Len() > 0 {
+		defer vm.NotifyBlockReady()
+	}
+
+	preferredBlock, err := vm.getBlock(vm.preferred)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get preferred block: %w", err)
+	}
+	data, err := encodePayload(&CorrectionPayload{Corrections: corrections})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't encode corrections: %w", err)
+	}
+	newBlock, err := vm.NewBlock(vm.preferred, preferredBlock.Height()+1, data, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build block: %w", err)
+	}
+	return newBlock, nil
+}
+
 // NotifyBlockReady tells the consensus engine that a new block
 // is ready to be created
 func (vm *VM) NotifyBlockReady() {
@@ -300,20 +718,34 @@ func (vm *VM) getBlock(blkID ids.ID) (*Block, error) {
 // LastAccepted returns the block most recently accepted
 func (vm *VM) LastAccepted(_ context.Context) (ids.ID, error) { return vm.state.GetLastAccepted() }
 
-// Hash the block or convert to string for comparison.
-func blockToString(block []byte) string {
-	return string(block) // Convert block byte array to string
-}
-
-// addZcashBlock appends [data] to [p.mempool].
+// addZcashBlock adds the JSON encoded Zcash block [data] to the mempool.
 // Then it notifies the consensus engine
 // that a new block is ready to be added to consensus
 // (namely, a block with data [data])
-func (vm *VM) addZcashBlock(block []byte) bool {
-
-	vm.mempool = append(vm.mempool, block)
+func (vm *VM) addZcashBlock(data []byte) error {
+	zblock, err := decodeZcashBlock(data)
+	if err != nil {
+		return err
+	}
+	attested, err := vm.isZcashBlockAttested(zblock)
+	if err != nil {
+		return err
+	}
+	if attested {
+		vm.metrics.dedupeHits.WithLabelValues(dedupeAttested).Inc()
+		return errBlockAlreadyReq
+	}
+	if err := vm.checkHeaderChain(zblock, nil); err != nil {
+		return err
+	}
+	if vm.mempool.Has(uint64(zblock.Height)) {
+		vm.metrics.dedupeHits.WithLabelValues(dedupeMempool).Inc()
+	}
+	if err := vm.mempool.Add(uint64(zblock.Height), data); err != nil {
+		return err
+	}
 	vm.NotifyBlockReady()
-	return true
+	return nil
 }
 
 // ParseBlock parses [bytes] to a snowman.Block
@@ -321,7 +753,6 @@ func (vm *VM) addZcashBlock(block []byte) bool {
 // and by the consensus layer when it receives the byte representation of a block
 // from another node
 func (vm *VM) ParseBlock(_ context.Context, bytes []byte) (snowman.Block, error) {
-	fmt.Printf("Parse Block :\n")
 	// A new empty block
 	block := &Block{}
 
@@ -349,7 +780,6 @@ func (vm *VM) ParseBlock(_ context.Context, bytes []byte) (snowman.Block, error)
 // - the block's data is [data]
 // - the block's timestamp is [timestamp]
 func (vm *VM) NewBlock(parentID ids.ID, height uint64, data []byte, timestamp time.Time) (*Block, error) {
-	fmt.Printf("NewBlock : \n")
 	block := &Block{
 		PrntID: parentID,
 		Hght:   height,
@@ -374,6 +804,8 @@ func (vm *VM) Shutdown(_ context.Context) error {
 	if vm.state == nil {
 		return nil
 	}
+	close(vm.shutdownChan)
+	vm.feed.close()
 
 	return vm.state.Close() // close versionDB
 }
@@ -411,6 +843,14 @@ func (vm *VM) onNormalOperationsStarted() error {
 		return nil
 	}
 	vm.bootstrapped.Set(true)
+
+	go vm.pollZcashTip()
+	if vm.config.FollowZcashTip {
+		go vm.followZcashTip(vm.followerStartHeight())
+	}
+	if vm.config.WatchReorgs {
+		go vm.watchReorgs()
+	}
 	return nil
 }
 
@@ -459,14 +899,166 @@ func (*VM) CrossChainAppResponse(_ context.Context, _ ids.ID, _ uint32, _ []byte
 	return nil
 }
 
-func (vm *VM) queryZcashBlock(ID uint64, validateConfirm bool) (*ZcashBlock, error) {
-	return vm.state.QueryZcashBlock(ID, validateConfirm)
+func (vm *VM) queryZcashBlock(ctx context.Context, ID uint64, validateConfirm bool) (*ZcashBlock, error) {
+	return vm.state.QueryZcashBlock(ctx, ID, validateConfirm)
+}
+
+func (vm *VM) verifyZcashHeader(ctx context.Context, zblock *ZcashBlock) error {
+	return vm.state.VerifyZcashHeader(ctx, zblock)
 }
 
 func (vm *VM) getBlockByHeight(ID uint64) (*Block, error) {
 	return vm.state.GetBlockByHeight(ID)
 }
 
-func (vm *VM) reconcileBlocks() ([]int, error) {
-	return vm.state.ReconcileBlocks()
+// getAttestedZcashBlock returns the accepted attestation of the Zcash block at
+// [height], or nil if that height wasn't attested
+func (vm *VM) getAttestedZcashBlock(height uint64) (*ZcashBlock, error) {
+	blk, err := vm.getBlockByHeight(height)
+	if err != nil || blk == nil {
+		return nil, err
+	}
+	return findAttestation(blk.Data(), height)
+}
+
+// isZcashBlockAttested returns true if an accepted block attests a Zcash
+// block with the height or the hash of [zblock]
+func (vm *VM) isZcashBlockAttested(zblock *ZcashBlock) (bool, error) {
+	_, err := vm.state.GetBlockIDByZcashHeight(uint64(zblock.Height))
+	if err != database.ErrNotFound {
+		return err == nil, err
+	}
+	if zblock.Hash == "" {
+		return false, nil
+	}
+	_, err = vm.state.GetBlockIDByZcashHash(zblock.Hash)
+	if err == database.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// isDuplicateAttestation returns true if [zblock] is in [pending] or already
+// attested by an accepted block
+func (vm *VM) isDuplicateAttestation(zblock *ZcashBlock, pending *attestationSet) (bool, error) {
+	if pending.Contains(zblock) {
+		return true, nil
+	}
+	return vm.isZcashBlockAttested(zblock)
+}
+
+// checkHeaderChain returns an error if StrictHeaderChain is set and the
+// attestation of the Zcash block before [zblock], either in [batch] or
+// accepted, doesn't build on it. It only applies to the Zcash blocks this
+// node queues and builds, other nodes may not enforce it.
+func (vm *VM) checkHeaderChain(zblock *ZcashBlock, batch map[int]*ZcashBlock) error {
+	if !vm.config.StrictHeaderChain || zblock.Height <= 1 {
+		return nil
+	}
+	prevZblock, ok := batch[zblock.Height-1]
+	if !ok {
+		var err error
+		prevZblock, err = vm.getAttestedZcashBlock(uint64(zblock.Height - 1))
+		if err != nil {
+			return err
+		}
+		if prevZblock == nil {
+			return nil
+		}
+	}
+	if prevZblock.Hash != zblock.PreviousBlockHash {
+		return fmt.Errorf("%w: previous block hash is %s but %s is attested at height %d",
+			errBrokenHeaderChain, zblock.PreviousBlockHash, prevZblock.Hash, prevZblock.Height)
+	}
+	return nil
+}
+
+// processingAttestations returns the Zcash blocks attested by [blkID] and
+// its ancestors that are verified but not yet accepted
+func (vm *VM) processingAttestations(blkID ids.ID) (*attestationSet, error) {
+	pending := newAttestationSet()
+	for {
+		blk, ok := vm.verifiedBlocks[blkID]
+		if !ok {
+			return pending, nil
+		}
+		zblocks, err := decodeAttestations(blk.Data())
+		if err != nil {
+			return nil, err
+		}
+		for _, zblock := range zblocks {
+			pending.Add(zblock)
+		}
+		blkID = blk.Parent()
+	}
+}
+
+// headerChainGaps walks the Zcash height index and reports the gaps and
+// breaks in the header chain of the attested Zcash blocks. The index is read
+// page by page, so that a long chain doesn't hold the lock for long.
+func (vm *VM) headerChainGaps() (*HeaderChainReport, error) {
+	report := &HeaderChainReport{}
+	var prev *ZcashBlock
+	for start := uint64(0); ; start = report.Highest + 1 {
+		zblocks, err := vm.attestedZcashPage(start, headerChainPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, zblock := range zblocks {
+			height := uint64(zblock.Height)
+			switch {
+			case prev == nil:
+				report.Lowest = height
+			case uint64(prev.Height)+1 < height:
+				report.Gaps = append(report.Gaps, HeaderChainGap{Start: uint64(prev.Height) + 1, End: height - 1})
+			case zblock.PreviousBlockHash != prev.Hash:
+				report.Breaks = append(report.Breaks, height)
+			}
+			report.Highest = height
+			report.Attested++
+			prev = zblock
+		}
+		if len(zblocks) < headerChainPageSize {
+			return report, nil
+		}
+	}
+}
+
+// attestedZcashPage returns up to [limit] attested Zcash blocks from the
+// Zcash height [start] on, in ascending order
+func (vm *VM) attestedZcashPage(start uint64, limit int) ([]*ZcashBlock, error) {
+	vm.snowCtx.Lock.Lock()
+	defer vm.snowCtx.Lock.Unlock()
+
+	heights, blkIDs, err := vm.state.GetZcashRange(start, math.MaxUint64, limit)
+	if err != nil {
+		return nil, err
+	}
+	zblocks := make([]*ZcashBlock, 0, len(heights))
+	// Consecutive heights are often attested by the same block
+	var (
+		blkID        ids.ID
+		attestations []*ZcashBlock
+	)
+	for i, height := range heights {
+		if blkIDs[i] != blkID || attestations == nil {
+			blkID = blkIDs[i]
+			blk, err := vm.getBlock(blkID)
+			if err != nil {
+				return nil, err
+			}
+			attestations, err = decodeAttestations(blk.Data())
+			if err != nil {
+				return nil, fmt.Errorf("couldn't decode block %s: %w", blkID, err)
+			}
+		}
+		idx := slices.IndexFunc(attestations, func(zblock *ZcashBlock) bool {
+			return uint64(zblock.Height) == height
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("block %s doesn't attest indexed zcash height %d", blkID, height)
+		}
+		zblocks = append(zblocks, attestations[idx])
+	}
+	return zblocks, nil
 }
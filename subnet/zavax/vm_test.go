@@ -5,24 +5,127 @@ package zavax
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ava-labs/avalanchego/database"
 	"github.com/ava-labs/avalanchego/database/memdb"
+	"github.com/ava-labs/avalanchego/database/prefixdb"
 	"github.com/ava-labs/avalanchego/ids"
 	"github.com/ava-labs/avalanchego/snow"
 	"github.com/ava-labs/avalanchego/snow/engine/common"
-	"github.com/ava-labs/avalanchego/version"
+	"github.com/ava-labs/avalanchego/snow/snowtest"
+	avajson "github.com/ava-labs/avalanchego/utils/json"
 	"github.com/stretchr/testify/require"
 )
 
 var blockchainID = ids.ID{1, 2, 3}
 
+// height of the Zcash tip reported by the test source
+const testZcashTip = 100
+
+var _ ZcashSource = &testZcashSource{}
+
+// testZcashSource is an in-memory ZcashSource of a chain mined with the
+// test Equihash parameters
+type testZcashSource struct {
+	tip     uint64
+	blocks  map[uint64]*ZcashBlock
+	headers map[string][]byte
+}
+
+func newTestZcashSource(tip uint64) *testZcashSource {
+	src := &testZcashSource{
+		tip:     tip,
+		blocks:  make(map[uint64]*ZcashBlock),
+		headers: make(map[string][]byte),
+	}
+	for height, header := range testZcashChain(tip) {
+		zblock := *header.zblock
+		zblock.Tx = slices.Clone(zblock.Tx)
+		src.blocks[uint64(height)+1] = &zblock
+		src.headers[zblock.Hash] = header.raw
+	}
+	return src
+}
+
+type testZcashHeaderEntry struct {
+	raw    []byte
+	zblock *ZcashBlock
+}
+
+var (
+	testZcashChainLock    sync.Mutex
+	testZcashChainHeaders []testZcashHeaderEntry
+)
+
+// testZcashChain returns the first [tip] mined test headers. Mining is
+// deterministic, so the headers are shared between tests.
+func testZcashChain(tip uint64) []testZcashHeaderEntry {
+	testZcashChainLock.Lock()
+	defer testZcashChainLock.Unlock()
+
+	for height := uint64(len(testZcashChainHeaders)) + 1; height <= tip; height++ {
+		prev := [32]byte{}
+		if height > 1 {
+			header, err := parseZcashHeader(testZcashChainHeaders[height-2].raw)
+			if err != nil {
+				panic(err)
+			}
+			prev = header.Hash()
+		}
+		raw, zblock := newTestZcashHeader(height, prev)
+		testZcashChainHeaders = append(testZcashChainHeaders, testZcashHeaderEntry{raw: raw, zblock: zblock})
+	}
+	return testZcashChainHeaders[:tip]
+}
+
+func (s *testZcashSource) GetBlockCount(context.Context) (uint64, error) {
+	return s.tip, nil
+}
+
+func (s *testZcashSource) GetBlockHash(_ context.Context, height uint64) (string, error) {
+	block, ok := s.blocks[height]
+	if !ok {
+		return "", errZcashEmptyResult
+	}
+	return block.Hash, nil
+}
+
+func (s *testZcashSource) GetBlock(_ context.Context, hash string) (*ZcashBlock, error) {
+	for _, block := range s.blocks {
+		if block.Hash == hash {
+			blockCopy := *block
+			return &blockCopy, nil
+		}
+	}
+	return nil, errZcashEmptyResult
+}
+
+func (s *testZcashSource) GetBlockHeader(_ context.Context, hash string) ([]byte, error) {
+	header, ok := s.headers[hash]
+	if !ok {
+		return nil, errZcashEmptyResult
+	}
+	return header, nil
+}
+
+func (*testZcashSource) GetRawTransaction(context.Context, string) (string, error) {
+	return "", errZcashEmptyResult
+}
+
 // require that after initialization, the vm has the state we expect
 func TestGenesis(t *testing.T) {
 	require := require.New(t)
 	ctx := context.TODO()
 	// Initialize the vm
-	vm, _, _, err := newTestVM()
+	vm, _, _, err := newTestVM(t)
 	require.NoError(err)
 	// Verify that the db is initialized
 	ok, err := vm.state.IsInitialized()
@@ -41,7 +144,7 @@ func TestGenesis(t *testing.T) {
 
 	// Verify that the genesis block has the data we expect
 	require.Equal(ids.Empty, genesisBlock.Parent())
-	require.Equal([32]byte{0, 0, 0, 0, 0}, genesisBlock.Data())
+	require.Equal([]byte{0, 0, 0, 0, 0}, genesisBlock.Data())
 }
 
 func TestHappyPath(t *testing.T) {
@@ -49,7 +152,7 @@ func TestHappyPath(t *testing.T) {
 	ctx := context.TODO()
 
 	// Initialize the vm
-	vm, snowCtx, msgChan, err := newTestVM()
+	vm, snowCtx, msgChan, err := newTestVM(t)
 	require.NoError(err)
 
 	lastAcceptedID, err := vm.LastAccepted(ctx)
@@ -61,7 +164,7 @@ func TestHappyPath(t *testing.T) {
 	require.NoError(vm.SetPreference(ctx, genesisBlock.ID()))
 
 	snowCtx.Lock.Lock()
-	vm.GetBlockByHeight([]byte{0, 0, 0, 0, 1}) // propose a value
+	proposeZcashBlock(t, vm, 1) // propose a value
 	snowCtx.Lock.Unlock()
 
 	select { // require there is a pending tx message to the engine
@@ -89,11 +192,10 @@ func TestHappyPath(t *testing.T) {
 
 	// require the block we accepted has the data we expect
 	require.Equal(genesisBlock.ID(), block2.Parent())
-	require.Equal([DataLen]byte{0, 0, 0, 0, 1}, block2.Data())
 	require.Equal(snowmanBlock2.ID(), block2.ID())
-	require.NoError(block2.Verify(ctx))
+	requireZcashHeight(t, block2, 1)
 
-	vm.proposeBlock([]byte{0, 0, 0, 0, 2}) // propose a block
+	proposeZcashBlock(t, vm, 2) // propose a block
 	snowCtx.Lock.Unlock()
 
 	select { // verify there is a pending tx message to the engine
@@ -120,9 +222,8 @@ func TestHappyPath(t *testing.T) {
 
 	// require the block we accepted has the data we expect
 	require.Equal(snowmanBlock2.ID(), block3.Parent())
-	require.Equal([DataLen]byte{0, 0, 0, 0, 2}, block3.Data())
 	require.Equal(snowmanBlock3.ID(), block3.ID())
-	require.NoError(block3.Verify(ctx))
+	requireZcashHeight(t, block3, 2)
 
 	// Next, check the blocks we added are there
 	block2FromState, err := vm.getBlock(block2.ID())
@@ -133,16 +234,249 @@ func TestHappyPath(t *testing.T) {
 	require.NoError(err)
 	require.Equal(snowmanBlock3.ID(), block3FromState.ID())
 
+	// The attested Zcash blocks can be found by their height
+	blockByHeight, err := vm.getBlockByHeight(2)
+	require.NoError(err)
+	require.Equal(block3.ID(), blockByHeight.ID())
+
 	snowCtx.Lock.Unlock()
 }
 
+// require that a block whose Zcash hash differs from the Zcash source fails
+// verification
+func TestVerifyHashMismatch(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+
+	zblock, err := vm.queryZcashBlock(ctx, 1, true)
+	require.NoError(err)
+	zblock.Hash = fmt.Sprintf("%064x", 999)
+	data, err := json.Marshal(zblock)
+	require.NoError(err)
+
+	lastAcceptedID, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	blk, err := vm.NewBlock(lastAcceptedID, 1, data, time.Now())
+	require.NoError(err)
+	require.ErrorIs(blk.Verify(ctx), errBlockNotMatch)
+}
+
+// require that a block whose fields aren't committed to by the Zcash header
+// fails verification, even though its hash is correct and the Zcash node
+// returns the same fields
+func TestVerifyHeaderMismatch(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+
+	src := vm.zcash.(*testZcashSource)
+	src.blocks[1].MerkleRoot = fmt.Sprintf("%064x", 999)
+	zblock, err := vm.queryZcashBlock(ctx, 1, true)
+	require.NoError(err)
+
+	lastAcceptedID, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	blk, err := vm.NewBlock(lastAcceptedID, 1, encodeTestPayload(t, zblock), time.Now())
+	require.NoError(err)
+	err = blk.Verify(ctx)
+	require.ErrorIs(err, errBlockNotMatch)
+	require.ErrorIs(err, errHeaderMismatch)
+}
+
+// require that every stable field of an attestation is checked against the
+// Zcash node, not only the hash
+func TestVerifyFullContent(t *testing.T) {
+	ctx := context.TODO()
+
+	tests := []struct {
+		name     string
+		tamper   func(*ZcashBlock)
+		expected error
+	}{
+		{
+			name:     "missing hash",
+			tamper:   func(zblock *ZcashBlock) { zblock.Hash = "" },
+			expected: errMissingAttestation,
+		},
+		{
+			name:     "time",
+			tamper:   func(zblock *ZcashBlock) { zblock.Time++ },
+			expected: errHeaderFieldMismatch,
+		},
+		{
+			name:     "root",
+			tamper:   func(zblock *ZcashBlock) { zblock.FinalSaplingRoot = fmt.Sprintf("%064x", 999) },
+			expected: errRootMismatch,
+		},
+		{
+			name:     "transactions",
+			tamper:   func(zblock *ZcashBlock) { zblock.Tx = append(zblock.Tx, fmt.Sprintf("%064x", 999)) },
+			expected: errTxMismatch,
+		},
+		{
+			name:     "chain supply",
+			tamper:   func(zblock *ZcashBlock) { zblock.ChainSupply.ChainValueZat++ },
+			expected: errValuePoolMismatch,
+		},
+		{
+			name: "value pools",
+			tamper: func(zblock *ZcashBlock) {
+				zblock.ValuePools = []ValuePool{{ID: "sapling", Monitored: true, ValueDeltaZat: 6}}
+			},
+			expected: errValuePoolMismatch,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			vm, _, _, err := newTestVM(t)
+			require.NoError(err)
+			src := vm.zcash.(*testZcashSource)
+			src.blocks[1].Tx = []string{fmt.Sprintf("%064x", 1)}
+			src.blocks[1].ValuePools = []ValuePool{{ID: "sapling", Monitored: true, ValueDeltaZat: 5}}
+
+			zblock, err := vm.queryZcashBlock(ctx, 1, true)
+			require.NoError(err)
+			test.tamper(zblock)
+
+			lastAcceptedID, err := vm.LastAccepted(ctx)
+			require.NoError(err)
+			blk, err := vm.NewBlock(lastAcceptedID, 1, encodeTestPayload(t, zblock), time.Now())
+			require.NoError(err)
+			err = blk.Verify(ctx)
+			require.ErrorIs(err, errBlockNotMatch)
+			require.ErrorIs(err, test.expected)
+		})
+	}
+}
+
+// require that Compare checks every field of an attestation, so that every
+// field the API serves is verified
+func TestAttestationCompareEveryField(t *testing.T) {
+	require := require.New(t)
+
+	_, zblock := newTestZcashHeader(1, [32]byte{})
+	zblock.ValuePools = []ValuePool{{ID: "sapling", Monitored: true, ValueDeltaZat: 5}}
+	attested := newAttestation(zblock)
+
+	fields := reflect.TypeOf(attested)
+	for i := 0; i < fields.NumField(); i++ {
+		actual := newAttestation(zblock)
+		actual.Tx = slices.Clone(actual.Tx)
+		actual.ValuePools = slices.Clone(actual.ValuePools)
+		field := reflect.ValueOf(&actual).Elem().Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(field.String() + "0")
+		case reflect.Int64:
+			field.SetInt(field.Int() + 1)
+		case reflect.Uint64:
+			field.SetUint(field.Uint() + 1)
+		case reflect.Slice:
+			field.Set(reflect.Append(field, reflect.Zero(field.Type().Elem())))
+		case reflect.Struct:
+			actual.ChainSupply.ChainValueZat++
+		default:
+			require.FailNow("unexpected attestation field kind", "%s is a %s", fields.Field(i).Name, field.Kind())
+		}
+		require.Error(attested.Compare(&actual), fields.Field(i).Name)
+	}
+}
+
+// require that a new VM syncing the chain from genesis verifies and accepts
+// the legacy JSON blocks that predate the codec payload, serving only their
+// attested fields, and that no block may use that format after a codec one
+func TestLegacyPayloadFromGenesis(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	zblock, err := vm.queryZcashBlock(ctx, 1, true)
+	require.NoError(err)
+	zblock.Confirmations = 1_000
+	zblock.Difficulty = 1e12
+	zblock.NextBlockHash = fmt.Sprintf("%064x", 999)
+	zblock.ChainSupply.ChainValue = 21_000_000
+	tampered, err := json.Marshal(zblock)
+	require.NoError(err)
+
+	// A historical legacy block with unstable fields that differ from the
+	// local zcashd
+	lastAcceptedID, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	blk, err := vm.NewBlock(lastAcceptedID, 1, tampered, time.Now())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+
+	service := Service{vm: vm, tracker: vm.tracker}
+	reply := GetBlockReply{}
+	require.NoError(service.GetBlockByHeight(nil, &QueryDataArgs{ID: 1}, &reply))
+	require.Equal(blk.ID(), reply.ID)
+	require.Zero(reply.Data.Confirmations)
+	require.Zero(reply.Data.Difficulty)
+	require.Empty(reply.Data.NextBlockHash)
+	require.Equal(zatsToZec(zblock.ChainSupply.ChainValueZat), reply.Data.ChainSupply.ChainValue)
+
+	// A tampered stable field still fails verification
+	zblock2, err := vm.queryZcashBlock(ctx, 2, true)
+	require.NoError(err)
+	zblock2.Time++
+	tampered, err = json.Marshal(zblock2)
+	require.NoError(err)
+	blk2, err := vm.NewBlock(blk.ID(), blk.Height()+1, tampered, time.Now())
+	require.NoError(err)
+	require.ErrorIs(blk2.Verify(ctx), errHeaderFieldMismatch)
+
+	// Legacy blocks may follow each other
+	zblock2.Time--
+	legacy, err := json.Marshal(zblock2)
+	require.NoError(err)
+	blk2, err = vm.NewBlock(blk.ID(), blk.Height()+1, legacy, time.Now())
+	require.NoError(err)
+	require.NoError(blk2.Verify(ctx))
+	require.NoError(blk2.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk2.ID()))
+
+	// but not a codec block
+	blk3 := acceptZcashBlock(t, vm, 3)
+	zblock4, err := vm.queryZcashBlock(ctx, 4, true)
+	require.NoError(err)
+	legacy, err = json.Marshal(zblock4)
+	require.NoError(err)
+	blk4, err := vm.NewBlock(blk3.ID(), blk3.Height()+1, legacy, time.Now())
+	require.NoError(err)
+	require.ErrorIs(blk4.Verify(ctx), errInvalidPayload)
+}
+
+// require that Zcash blocks without enough confirmations can't be queried
+func TestQueryUnconfirmedZcashBlock(t *testing.T) {
+	require := require.New(t)
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+
+	_, err = vm.queryZcashBlock(context.TODO(), testZcashTip, true)
+	require.ErrorIs(err, errBlockHeightNotAllowed)
+
+	_, err = vm.queryZcashBlock(context.TODO(), testZcashTip, false)
+	require.NoError(err)
+}
+
 func TestService(t *testing.T) {
 	// Initialize the vm
 	require := require.New(t)
 	// Initialize the vm
-	vm, _, _, err := newTestVM()
+	vm, _, _, err := newTestVM(t)
 	require.NoError(err)
-	service := Service{vm}
+	service := Service{vm: vm, tracker: vm.tracker}
 	require.NoError(service.GetBlock(nil, &GetBlockArgs{}, &GetBlockReply{}))
 }
 
@@ -151,7 +485,7 @@ func TestSetState(t *testing.T) {
 	require := require.New(t)
 	ctx := context.TODO()
 	// Initialize the vm
-	vm, _, _, err := newTestVM()
+	vm, _, _, err := newTestVM(t)
 	require.NoError(err)
 	// bootstrapping
 	require.NoError(vm.SetState(ctx, snow.Bootstrapping))
@@ -164,12 +498,490 @@ func TestSetState(t *testing.T) {
 	require.ErrorIs(vm.SetState(ctx, unknownState), snow.ErrUnknownState)
 }
 
-func newTestVM() (*VM, *snow.Context, chan common.Message, error) {
+// require that in strict mode a node doesn't queue or build a Zcash block
+// that doesn't extend the attested block at the height below it, while
+// accepting such blocks built by other nodes
+func TestStrictHeaderChain(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVMWithConfig(t, map[string]interface{}{"strictHeaderChain": true})
+	require.NoError(err)
+
+	blk1 := acceptZcashBlock(t, vm, 1)
+	forkZcashSource(vm, 2)
+
+	fork, err := vm.queryZcashBlock(ctx, 2, true)
+	require.NoError(err)
+	data, err := json.Marshal(fork)
+	require.NoError(err)
+	require.ErrorIs(vm.addZcashBlock(data), errBrokenHeaderChain)
+
+	// A block built by a node that doesn't enforce it is valid
+	blk, err := vm.NewBlock(blk1.ID(), blk1.Height()+1, encodeTestPayload(t, fork), time.Now())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Reject(ctx))
+
+	// A Zcash block queued before the block below it was attested is
+	// dropped when built after it
+	forkZcashSource(vm, 4)
+	proposeZcashBlock(t, vm, 3)
+	fork, err = vm.queryZcashBlock(ctx, 4, true)
+	require.NoError(err)
+	data, err = json.Marshal(fork)
+	require.NoError(err)
+	service := Service{vm: vm, tracker: vm.tracker}
+	require.NoError(service.queueZcashBlock(4, data))
+	built, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	requireZcashHeight(t, built.(*Block), 3)
+	require.Zero(vm.mempool.Len())
+	status, err := vm.tracker.Status(4)
+	require.NoError(err)
+	require.NotNil(status)
+	require.Equal(RequestFailed, status.State)
+
+	// Heights without an attestation below them are not constrained
+	acceptZcashBlock(t, vm, 6)
+}
+
+// require that the gaps and breaks of the attested header chain are reported
+func TestHeaderChainGaps(t *testing.T) {
+	require := require.New(t)
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	service := Service{vm: vm, tracker: vm.tracker}
+
+	reply := GetHeaderChainGapsReply{}
+	require.NoError(service.GetHeaderChainGaps(nil, nil, &reply))
+	require.Zero(reply.Attested)
+
+	acceptZcashBlock(t, vm, 1)
+	forkZcashSource(vm, 2)
+	acceptZcashBlock(t, vm, 2)
+	acceptZcashBlock(t, vm, 5)
+	acceptZcashBlock(t, vm, 7)
+
+	require.NoError(service.GetHeaderChainGaps(nil, nil, &reply))
+	require.Equal(GetHeaderChainGapsReply{
+		Lowest:   1,
+		Highest:  7,
+		Attested: 4,
+		Gaps: []HeaderChainGapReply{
+			{Start: 3, End: 4},
+			{Start: 6, End: 6},
+		},
+		Breaks: []avajson.Uint64{2},
+	}, reply)
+}
+
+// require that the Zcash index of a database that predates it is rebuilt on
+// startup
+func TestRebuildZcashIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	blk1 := acceptZcashBlock(t, vm, 1)
+	blk3 := acceptZcashBlock(t, vm, 3)
+	require.NoError(vm.Shutdown(ctx))
+
+	// Drop the index as if it was never built
+	db := vm.dbManager
+	for _, prefix := range [][]byte{zcashHeightPrefix, zcashHashPrefix} {
+		require.NoError(database.Clear(prefixdb.New(prefix, db), 1024))
+	}
+	require.NoError(prefixdb.New(singletonStatePrefix, db).Delete(isZcashIndexedKey))
+
+	restarted := &VM{zcash: vm.zcash, equihashN: vm.equihashN, equihashK: vm.equihashK}
+	config, err := json.Marshal(vm.config)
+	require.NoError(err)
+	require.NoError(restarted.Initialize(ctx, snowtest.Context(t, blockchainID), db, []byte{0, 0, 0, 0, 0}, nil, config, make(chan common.Message, 1), nil, nil))
+
+	indexed, err := restarted.state.IsZcashIndexed()
+	require.NoError(err)
+	require.True(indexed)
+
+	for height, expected := range map[uint64]ids.ID{1: blk1.ID(), 3: blk3.ID()} {
+		blk, err := restarted.getBlockByHeight(height)
+		require.NoError(err)
+		require.Equal(expected, blk.ID())
+	}
+	blk, err := restarted.getBlockByHeight(2)
+	require.NoError(err)
+	require.Nil(blk)
+
+	zblock3, err := findAttestation(blk3.Data(), 3)
+	require.NoError(err)
+	blkID, err := restarted.state.GetBlockIDByZcashHash(zblock3.Hash)
+	require.NoError(err)
+	require.Equal(blk3.ID(), blkID)
+}
+
+// require that the transactions of the attested Zcash blocks are indexed, and
+// that the index of a database that predates it is rebuilt
+func TestZcashTxIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	src := vm.zcash.(*testZcashSource)
+	txID := func(height uint64) string {
+		return fmt.Sprintf("%064x", 100+height)
+	}
+	src.blocks[1].Tx = []string{txID(1)}
+	src.blocks[2].Tx = []string{txID(2), txID(0)}
+	blk1 := acceptZcashBlock(t, vm, 1)
+	blk2 := acceptZcashBlock(t, vm, 2)
+	require.NoError(vm.Shutdown(ctx))
+
+	// Drop the transaction index as if it was never built
+	db := vm.dbManager
+	require.NoError(database.Clear(prefixdb.New(zcashTxPrefix, db), 1024))
+	require.NoError(prefixdb.New(singletonStatePrefix, db).Delete(isTxIndexedKey))
+
+	restarted := &VM{zcash: vm.zcash, equihashN: vm.equihashN, equihashK: vm.equihashK}
+	config, err := json.Marshal(vm.config)
+	require.NoError(err)
+	require.NoError(restarted.Initialize(ctx, snowtest.Context(t, blockchainID), db, []byte{0, 0, 0, 0, 0}, nil, config, make(chan common.Message, 1), nil, nil))
+
+	indexed, err := restarted.state.IsTxIndexed()
+	require.NoError(err)
+	require.True(indexed)
+
+	service := Service{vm: restarted, tracker: restarted.tracker}
+	for tx, expected := range map[string]*Block{txID(1): blk1, txID(2): blk2, strings.ToUpper(txID(0)): blk2} {
+		reply := GetBlockReply{}
+		require.NoError(service.GetBlockByTxID(nil, &GetBlockByTxIDArgs{TxID: tx}, &reply))
+		require.Equal(expected.ID(), reply.ID)
+		require.Contains(reply.Data.Tx, strings.ToLower(tx))
+	}
+	err = service.GetBlockByTxID(nil, &GetBlockByTxIDArgs{TxID: txID(3)}, &GetBlockReply{})
+	require.ErrorIs(err, errNoSuchTx)
+
+	reply := GetBlockReply{}
+	require.NoError(service.GetBlockByZcashHash(nil, &GetBlockByZcashHashArgs{Hash: strings.ToUpper(src.blocks[1].Hash)}, &reply))
+	require.Equal(blk1.ID(), reply.ID)
+	require.Equal(1, reply.Data.Height)
+	err = service.GetBlockByZcashHash(nil, &GetBlockByZcashHashArgs{Hash: strings.Repeat("00", 32)}, &reply)
+	require.ErrorIs(err, errNoSuchZcashHash)
+}
+
+// require that accepted blocks are indexed by height, and that the height
+// index of a database that predates it is backfilled
+func TestHeightIndex(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	require.NoError(vm.VerifyHeightIndex(ctx))
+
+	genesisID, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	expected := []ids.ID{genesisID}
+	for height := uint64(1); height <= 3; height++ {
+		expected = append(expected, acceptZcashBlock(t, vm, height).ID())
+	}
+	for height, blkID := range expected {
+		id, err := vm.GetBlockIDAtHeight(ctx, uint64(height))
+		require.NoError(err)
+		require.Equal(blkID, id)
+	}
+	_, err = vm.GetBlockIDAtHeight(ctx, uint64(len(expected)))
+	require.ErrorIs(err, database.ErrNotFound)
+
+	snowCtx.Lock.Lock()
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+
+	// Drop the height index as if it was never built
+	db := vm.dbManager
+	require.NoError(database.Clear(prefixdb.New(heightIndexPrefix, db), 1024))
+	require.NoError(prefixdb.New(singletonStatePrefix, db).Delete(isHeightIndexedKey))
+
+	restarted := &VM{zcash: vm.zcash, equihashN: vm.equihashN, equihashK: vm.equihashK}
+	config, err := json.Marshal(vm.config)
+	require.NoError(err)
+	require.NoError(restarted.Initialize(ctx, snowtest.Context(t, blockchainID), db, []byte{0, 0, 0, 0, 0}, nil, config, make(chan common.Message, 1), nil, nil))
+
+	require.Eventually(func() bool {
+		return restarted.VerifyHeightIndex(ctx) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	for height, blkID := range expected {
+		id, err := restarted.GetBlockIDAtHeight(ctx, uint64(height))
+		require.NoError(err)
+		require.Equal(blkID, id)
+	}
+}
+
+// require that pending Zcash blocks are batched within the block limits, and
+// that every attested block is verified and indexed
+func TestBatchAttestations(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVMWithConfig(t, map[string]interface{}{
+		"maxBlockAttestations": 3,
+		"strictHeaderChain":    true,
+	})
+	require.NoError(err)
+
+	for height := uint64(1); height <= 4; height++ {
+		proposeZcashBlock(t, vm, height)
+	}
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+
+	zblocks, err := decodeAttestations(blk.(*Block).Data())
+	require.NoError(err)
+	require.Len(zblocks, 3)
+	for height := uint64(1); height <= 3; height++ {
+		indexed, err := vm.getBlockByHeight(height)
+		require.NoError(err)
+		require.Equal(blk.ID(), indexed.ID())
+	}
+
+	// The remaining Zcash block is built into the next block
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	requireZcashHeight(t, blk.(*Block), 4)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+
+	// The reply describes the requested Zcash block
+	service := Service{vm: vm, tracker: vm.tracker}
+	reply := GetBlockReply{}
+	require.NoError(service.GetBlockByHeight(nil, &QueryDataArgs{ID: 2}, &reply))
+	require.Equal(2, reply.Data.Height)
+	require.Len(reply.Attestations, 3)
+
+	// A batch with an invalid entry is rejected
+	valid, err := vm.queryZcashBlock(ctx, 6, true)
+	require.NoError(err)
+	invalid, err := vm.queryZcashBlock(ctx, 7, true)
+	require.NoError(err)
+	invalid.Hash = fmt.Sprintf("%064x", 999)
+	lastAcceptedID, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	lastAccepted, err := vm.getBlock(lastAcceptedID)
+	require.NoError(err)
+	batch, err := vm.NewBlock(lastAcceptedID, lastAccepted.Height()+1, encodeTestPayload(t, valid, invalid), time.Now())
+	require.NoError(err)
+	require.ErrorIs(batch.Verify(ctx), errBlockNotMatch)
+
+	// A batch over the limit of this node's config but within the protocol
+	// limits, built by another node, is valid
+	zblocks = nil
+	for height := 6; height <= 9; height++ {
+		zblock, err := vm.queryZcashBlock(ctx, uint64(height), true)
+		require.NoError(err)
+		zblocks = append(zblocks, zblock)
+	}
+	batch, err = vm.NewBlock(lastAcceptedID, lastAccepted.Height()+1, encodeTestPayload(t, zblocks...), time.Now())
+	require.NoError(err)
+	require.NoError(batch.Verify(ctx))
+
+	// A batch over the protocol limit is rejected
+	zblocks = make([]*ZcashBlock, MaxBlockAttestations+1)
+	for i := range zblocks {
+		zblocks[i] = valid
+	}
+	tooLarge, err := vm.NewBlock(lastAcceptedID, lastAccepted.Height()+1, encodeTestPayload(t, zblocks...), time.Now())
+	require.NoError(err)
+	require.ErrorIs(tooLarge.Verify(ctx), errBatchTooLarge)
+
+	// and so is a config allowing larger blocks
+	config := Config{}
+	config.SetDefaults()
+	config.MaxBlockAttestations = MaxBlockAttestations + 1
+	require.ErrorIs(config.Verify(), errAttestationLimit)
+	config.SetDefaults()
+	config.MaxBlockDataSize = MaxBlockDataSize + 1
+	require.ErrorIs(config.Verify(), errDataTooLarge)
+}
+
+// require that a Zcash height is attested at most once, even when the Zcash
+// node returns different data for it
+func TestDeduplicateAttestations(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+	blk1 := acceptZcashBlock(t, vm, 1)
+
+	// The confirmations of the attested block changed since
+	zblock, err := vm.queryZcashBlock(ctx, 1, true)
+	require.NoError(err)
+	zblock.Confirmations++
+	data, err := json.Marshal(zblock)
+	require.NoError(err)
+	require.ErrorIs(vm.addZcashBlock(data), errBlockAlreadyReq)
+
+	// Verify rejects it as well
+	blk, err := vm.NewBlock(blk1.ID(), blk1.Height()+1, encodeTestPayload(t, zblock), time.Now())
+	require.NoError(err)
+	require.ErrorIs(blk.Verify(ctx), errBlockAlreadyReq)
+
+	// A height attested by a processing ancestor isn't built again
+	proposeZcashBlock(t, vm, 2)
+	blk2, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk2.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk2.ID()))
+	vm.mempool.Requeue([]uint64{2})
+	_, err = vm.BuildBlock(ctx)
+	require.Error(err)
+
+	// Nor verified on top of it
+	zblock2, err := vm.queryZcashBlock(ctx, 2, true)
+	require.NoError(err)
+	blk3, err := vm.NewBlock(blk2.ID(), blk2.Height()+1, encodeTestPayload(t, zblock2), time.Now())
+	require.NoError(err)
+	require.ErrorIs(blk3.Verify(ctx), errBlockAlreadyReq)
+
+	// Nor accepted twice
+	require.NoError(blk2.Accept(ctx))
+	sibling, err := vm.NewBlock(blk1.ID(), blk1.Height()+1, encodeTestPayload(t, zblock2), time.Now())
+	require.NoError(err)
+	require.ErrorIs(sibling.Accept(ctx), errBlockAlreadyReq)
+}
+
+// require that validators encode a Zcash block to the same bytes whatever
+// the volatile fields returned by their zcashd, and that blocks holding JSON
+// attestations remain readable
+func TestCanonicalPayload(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, _, _, err := newTestVM(t)
+	require.NoError(err)
+
+	zblock, err := vm.queryZcashBlock(ctx, 1, true)
+	require.NoError(err)
+	zblock.Tx = []string{fmt.Sprintf("%064x", 1)}
+	zblock.ChainSupply = ChainSupply{Monitored: true, ChainValue: 12.5, ChainValueZat: 1_250_000_000}
+	zblock.ValuePools = []ValuePool{{ID: "sapling", Monitored: true, ChainValue: 0.5, ChainValueZat: 50_000_000}}
+	other := *zblock
+	other.Confirmations += 10
+	other.Difficulty = 2
+	other.NextBlockHash = fmt.Sprintf("%064x", 2)
+	require.Equal(encodeTestPayload(t, zblock), encodeTestPayload(t, &other))
+
+	// The stable fields round trip
+	decoded, err := decodeAttestations(encodeTestPayload(t, zblock))
+	require.NoError(err)
+	require.Len(decoded, 1)
+	expected := *zblock
+	expected.Confirmations = 0
+	expected.Difficulty = 0
+	require.Equal(&expected, decoded[0])
+
+	// Built blocks hold the codec payload
+	blk := acceptZcashBlock(t, vm, 1)
+	var payload Payload
+	_, err = Codec.Unmarshal(blk.Data(), &payload)
+	require.NoError(err)
+	require.Len(payload.ZcashBlocks(), 1)
+
+	// A block built before the codec payload holds the JSON of the Zcash
+	// block, which can't follow a codec block
+	zblock2, err := vm.queryZcashBlock(ctx, 2, true)
+	require.NoError(err)
+	zblock2.Confirmations = 50
+	legacy, err := json.Marshal(zblock2)
+	require.NoError(err)
+	legacyBlk, err := vm.NewBlock(blk.ID(), blk.Height()+1, legacy, time.Now())
+	require.NoError(err)
+	require.ErrorIs(legacyBlk.Verify(ctx), errInvalidPayload)
+
+	// Undecodable data is rejected
+	garbage, err := vm.NewBlock(blk.ID(), blk.Height()+1, []byte{0, 0, 0xff}, time.Now())
+	require.NoError(err)
+	require.ErrorIs(garbage.Verify(ctx), errBlockNotMatch)
+}
+
+// encodeTestPayload returns the data of a block attesting [zblocks]
+func encodeTestPayload(t *testing.T, zblocks ...*ZcashBlock) []byte {
+	attestations := make([]Attestation, len(zblocks))
+	for i, zblock := range zblocks {
+		attestations[i] = newAttestation(zblock)
+	}
+	data, err := encodePayload(&AttestationPayload{Attestations: attestations})
+	require.NoError(t, err)
+	return data
+}
+
+// proposeZcashBlock adds the Zcash block at [height] to the mempool of [vm]
+func proposeZcashBlock(t *testing.T, vm *VM, height uint64) {
+	zblock, err := vm.queryZcashBlock(context.TODO(), height, true)
+	require.NoError(t, err)
+	data, err := json.Marshal(zblock)
+	require.NoError(t, err)
+	require.NoError(t, vm.addZcashBlock(data))
+}
+
+// requireZcashHeight requires that [blk] only attests the Zcash block at
+// [height]
+func requireZcashHeight(t *testing.T, blk *Block, height int) {
+	zblocks, err := decodeAttestations(blk.Data())
+	require.NoError(t, err)
+	require.Len(t, zblocks, 1)
+	require.Equal(t, height, zblocks[0].Height)
+}
+
+// acceptZcashBlock builds, verifies and accepts a block attesting the Zcash
+// block at [height]
+func acceptZcashBlock(t *testing.T, vm *VM, height uint64) *Block {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	proposeZcashBlock(t, vm, height)
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	return blk.(*Block)
+}
+
+// forkZcashSource replaces the Zcash block at [height] of [vm]'s source with a
+// block that doesn't build on the block below it
+func forkZcashSource(vm *VM, height uint64) {
+	src := vm.zcash.(*testZcashSource)
+	raw, zblock := newTestZcashHeader(height, [32]byte{0xff})
+	src.blocks[height] = zblock
+	src.headers[zblock.Hash] = raw
+}
+
+func newTestVM(t *testing.T) (*VM, *snow.Context, chan common.Message, error) {
+	return newTestVMWithConfig(t, nil)
+}
+
+// newTestVMWithConfig initializes a VM with the test Equihash parameters and
+// the chain config overrides in [config]
+func newTestVMWithConfig(t *testing.T, config map[string]interface{}) (*VM, *snow.Context, chan common.Message, error) {
 	dbManager := memdb.New()
 	msgChan := make(chan common.Message, 1)
-	vm := &VM{}
-	snowCtx := snow.DefaultContextTest()
-	snowCtx.ChainID = blockchainID
-	err := vm.Initialize(context.TODO(), snowCtx, dbManager, []byte{0, 0, 0, 0, 0}, nil, nil, msgChan, nil, nil)
+	vm := &VM{
+		zcash:     newTestZcashSource(testZcashTip),
+		equihashN: testEquihashN,
+		equihashK: testEquihashK,
+	}
+	snowCtx := snowtest.Context(t, blockchainID)
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = vm.Initialize(context.TODO(), snowCtx, dbManager, []byte{0, 0, 0, 0, 0}, nil, configBytes, msgChan, nil, nil)
 	return vm, snowCtx, msgChan, err
 }
@@ -0,0 +1,100 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWaitTimeout is how long getBlockByHeight waits for an
+	// attestation to be accepted when no timeout is given
+	DefaultWaitTimeout = 30 * time.Second
+	// MaxWaitTimeout bounds the timeout of getBlockByHeight
+	MaxWaitTimeout = 5 * time.Minute
+)
+
+var (
+	errWaitTimeout        = errors.New("timed out waiting for the zcash block to be attested")
+	errAttestationDropped = errors.New("the zcash block failed verification and was dropped")
+	errInvalidWaitTimeout = errors.New("invalid wait timeout")
+)
+
+// attestationResult is the outcome of the attestation of a Zcash height:
+// either the accepted block attesting it, or the error it was dropped with
+type attestationResult struct {
+	blk *Block
+	err error
+}
+
+// attestationWaiters notifies the callers waiting on Zcash heights once their
+// attestation is accepted or dropped
+type attestationWaiters struct {
+	lock sync.Mutex
+	// Zcash height --> channels of the callers waiting on it
+	waiting map[uint64][]chan attestationResult
+}
+
+func newAttestationWaiters() *attestationWaiters {
+	return &attestationWaiters{
+		waiting: make(map[uint64][]chan attestationResult),
+	}
+}
+
+// wait returns a channel that receives the outcome of the attestation of the
+// Zcash block at [height]. The returned func must be called once the caller
+// stops waiting.
+func (w *attestationWaiters) wait(height uint64) (<-chan attestationResult, func()) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	ch := make(chan attestationResult, 1)
+	w.waiting[height] = append(w.waiting[height], ch)
+	return ch, func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+
+		chans := w.waiting[height]
+		for i, waiting := range chans {
+			if waiting == ch {
+				chans = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		if len(chans) == 0 {
+			delete(w.waiting, height)
+		} else {
+			w.waiting[height] = chans
+		}
+	}
+}
+
+// notify sends [result] to every caller waiting on [height]
+func (w *attestationWaiters) notify(height uint64, result attestationResult) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, ch := range w.waiting[height] {
+		ch <- result
+	}
+	delete(w.waiting, height)
+}
+
+// accepted notifies the callers waiting on the Zcash heights attested by the
+// accepted block [blk]
+func (w *attestationWaiters) accepted(blk *Block, zblocks []*ZcashBlock) {
+	for _, zblock := range zblocks {
+		w.notify(uint64(zblock.Height), attestationResult{blk: blk})
+	}
+}
+
+// dropped notifies the callers waiting on [heights] that they were dropped
+// because of [err]
+func (w *attestationWaiters) dropped(heights []uint64, err error) {
+	for _, height := range heights {
+		w.notify(height, attestationResult{err: err})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForBlock(t *testing.T) {
+	require := require.New(t)
+	ctx := context.TODO()
+
+	vm, snowCtx, _, err := newTestVM(t)
+	require.NoError(err)
+	service := Service{vm: vm, tracker: vm.tracker}
+
+	// waitForHeight calls getBlockByHeight in wait mode until a waiter is
+	// registered for [height]
+	waitForHeight := func(height uint64) (*GetBlockReply, chan error) {
+		reply := &GetBlockReply{}
+		done := make(chan error, 1)
+		go func() {
+			args := &QueryDataArgs{ID: height, Wait: true, Timeout: Duration{5 * time.Second}}
+			done <- service.GetBlockByHeight(httptest.NewRequest("POST", "/", nil), args, reply)
+		}()
+		require.Eventually(func() bool {
+			vm.waiters.lock.Lock()
+			defer vm.waiters.lock.Unlock()
+			return len(vm.waiters.waiting[height]) > 0
+		}, 5*time.Second, time.Millisecond)
+		return reply, done
+	}
+
+	// The reply is the accepted block attesting the height
+	reply, done := waitForHeight(40)
+	snowCtx.Lock.Lock()
+	require.True(vm.mempool.Has(40))
+	blk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	snowCtx.Lock.Unlock()
+	require.NoError(<-done)
+	require.Equal(blk.ID(), reply.ID)
+	require.Equal(40, reply.Data.Height)
+
+	// A height that isn't attested in time stays in the mempool
+	args := &QueryDataArgs{ID: 41, Wait: true, Timeout: Duration{10 * time.Millisecond}}
+	require.ErrorIs(service.GetBlockByHeight(httptest.NewRequest("POST", "/", nil), args, &GetBlockReply{}), errWaitTimeout)
+	snowCtx.Lock.Lock()
+	require.True(vm.mempool.Has(41))
+	snowCtx.Lock.Unlock()
+
+	// A height that fails verification is dropped
+	_, done = waitForHeight(41)
+	snowCtx.Lock.Lock()
+	blk, err = vm.BuildBlock(ctx)
+	require.NoError(err)
+	forkZcashSource(vm, 41)
+	require.ErrorIs(blk.Verify(ctx), errBlockNotMatch)
+	snowCtx.Lock.Unlock()
+	require.ErrorIs(<-done, errAttestationDropped)
+
+	args.Timeout = Duration{MaxWaitTimeout + time.Second}
+	require.ErrorIs(service.GetBlockByHeight(httptest.NewRequest("POST", "/", nil), args, &GetBlockReply{}), errInvalidWaitTimeout)
+
+	snowCtx.Lock.Lock()
+	require.Empty(vm.waiters.waiting)
+	require.NoError(vm.Shutdown(ctx))
+	snowCtx.Lock.Unlock()
+}
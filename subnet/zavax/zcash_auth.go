@@ -0,0 +1,105 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	errConflictingCredentials = errors.New("zcash rpc cookie file can't be combined with a user or password")
+	errMalformedCookie        = errors.New("zcash rpc cookie file is malformed")
+	errMissingEnvVar          = errors.New("zcash rpc credential environment variable is not set")
+)
+
+// ZcashCredentials describes how to authenticate against zcashd. Each value
+// can be given directly, through an environment variable or through a file.
+// The cookie file written by zcashd can be used instead of a user/password.
+//
+// Credentials are resolved on every request, so rotated passwords and
+// regenerated cookies are picked up without restarting the node.
+type ZcashCredentials struct {
+	User         string `serialize:"true" json:"rpcUser"`
+	UserEnv      string `serialize:"true" json:"rpcUserEnv"`
+	Password     string `serialize:"true" json:"rpcPassword"`
+	PasswordEnv  string `serialize:"true" json:"rpcPasswordEnv"`
+	PasswordFile string `serialize:"true" json:"rpcPasswordFile"`
+	CookieFile   string `serialize:"true" json:"rpcCookieFile"`
+}
+
+// Verify returns an error if the credential sources conflict
+func (c *ZcashCredentials) Verify() error {
+	hasUserPassword := c.User != "" || c.UserEnv != "" ||
+		c.Password != "" || c.PasswordEnv != "" || c.PasswordFile != ""
+	if c.CookieFile != "" && hasUserPassword {
+		return errConflictingCredentials
+	}
+	return nil
+}
+
+// resolve returns the user and password to send to zcashd. [ok] is false if
+// no credentials are configured.
+func (c *ZcashCredentials) resolve() (user string, password string, ok bool, err error) {
+	if c.CookieFile != "" {
+		return readCookieFile(c.CookieFile)
+	}
+
+	user, err = resolveSecret(c.User, c.UserEnv, "")
+	if err != nil {
+		return "", "", false, err
+	}
+	password, err = resolveSecret(c.Password, c.PasswordEnv, c.PasswordFile)
+	if err != nil {
+		return "", "", false, err
+	}
+	return user, password, user != "" || password != "", nil
+}
+
+// apply sets the Basic auth header of [req] if credentials are configured
+func (c *ZcashCredentials) apply(req *http.Request) error {
+	user, password, ok, err := c.resolve()
+	if err != nil || !ok {
+		return err
+	}
+	req.SetBasicAuth(user, password)
+	return nil
+}
+
+// resolveSecret returns the first configured value of [file], [env] and
+// [value], in that order of precedence
+func resolveSecret(value string, env string, file string) (string, error) {
+	switch {
+	case file != "":
+		secret, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("couldn't read zcash rpc secret file: %w", err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	case env != "":
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", errMissingEnvVar, env)
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
+
+// readCookieFile parses the "user:password" cookie written by zcashd
+func readCookieFile(path string) (string, string, bool, error) {
+	cookie, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false, fmt.Errorf("couldn't read zcash rpc cookie file: %w", err)
+	}
+	user, password, found := strings.Cut(strings.TrimSpace(string(cookie)), ":")
+	if !found {
+		return "", "", false, errMalformedCookie
+	}
+	return user, password, true, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errZcashUnavailable = errors.New("zcash node is unavailable, try again later")
+
+// circuitBreaker stops requests to a zcashd after [threshold] consecutive
+// failed calls. Once [cooldown] has passed, a single probe request is let
+// through; if it succeeds the breaker closes again.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	lock     sync.Mutex
+	failures int
+	// openedAt is the time the breaker opened, zero while closed
+	openedAt time.Time
+	// probing is set while the probe request of a half-open breaker is in
+	// flight
+	probing bool
+}
+
+// newCircuitBreaker returns a breaker tripping after [threshold] failures.
+// A threshold of 0 disables the breaker.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns errZcashUnavailable if requests should fail fast
+func (b *circuitBreaker) allow() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.openedAt.IsZero() {
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return errZcashUnavailable
+	}
+	b.probing = true
+	return nil
+}
+
+// success records a call that reached zcashd
+func (b *circuitBreaker) success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.probing = false
+}
+
+// failure records a call that couldn't reach zcashd
+func (b *circuitBreaker) failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.probing || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+// abort releases a probe that ended without reaching a verdict, e.g. because
+// the caller gave up
+func (b *circuitBreaker) abort() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.probing = false
+}
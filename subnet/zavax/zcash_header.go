@@ -0,0 +1,209 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+const (
+	// size of a Zcash block header without its Equihash solution
+	zcashHeaderPrefixLen = 140
+
+	// heartwoodHeight is the lowest Heartwood activation height of Zcash
+	// mainnet (903000) and testnet (903800). Below it, the commitments field
+	// of a header holds the final Sapling root, zero before Sapling. From
+	// Heartwood it holds the chain history root, and from NU5 the hash of
+	// the block commitments.
+	heartwoodHeight = 903_000
+)
+
+var (
+	errInvalidZcashHeader = errors.New("invalid zcash block header")
+	errHeaderMismatch     = errors.New("zcash block header does not match the attested block")
+	errInsufficientWork   = errors.New("zcash block hash is above its target")
+)
+
+// zcashHeader is a parsed Zcash block header. Hashes are kept in their
+// serialized (little endian) byte order. BlockCommitments is the field zcashd
+// reports as blockcommitments at every height.
+type zcashHeader struct {
+	Version          int32
+	PrevBlockHash    [32]byte
+	MerkleRoot       [32]byte
+	BlockCommitments [32]byte
+	Time             uint32
+	Bits             uint32
+	Nonce            [32]byte
+	Solution         []byte
+
+	// raw is the serialized header
+	raw []byte
+}
+
+// parseZcashHeader parses the serialized header [raw] as returned by
+// `getblockheader <hash> false`
+func parseZcashHeader(raw []byte) (*zcashHeader, error) {
+	if len(raw) < zcashHeaderPrefixLen+1 {
+		return nil, fmt.Errorf("%w: %d bytes", errInvalidZcashHeader, len(raw))
+	}
+
+	h := &zcashHeader{raw: raw}
+	h.Version = int32(binary.LittleEndian.Uint32(raw[0:4]))
+	copy(h.PrevBlockHash[:], raw[4:36])
+	copy(h.MerkleRoot[:], raw[36:68])
+	copy(h.BlockCommitments[:], raw[68:100])
+	h.Time = binary.LittleEndian.Uint32(raw[100:104])
+	h.Bits = binary.LittleEndian.Uint32(raw[104:108])
+	copy(h.Nonce[:], raw[108:140])
+
+	solutionLen, n, err := readCompactSize(raw[zcashHeaderPrefixLen:])
+	if err != nil {
+		return nil, err
+	}
+	solution := raw[zcashHeaderPrefixLen+n:]
+	if uint64(len(solution)) != solutionLen {
+		return nil, fmt.Errorf("%w: solution is %d bytes, expected %d", errInvalidZcashHeader, len(solution), solutionLen)
+	}
+	h.Solution = solution
+	return h, nil
+}
+
+// readCompactSize decodes a Bitcoin style variable length integer, returning
+// the value and the number of bytes read
+func readCompactSize(b []byte) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, fmt.Errorf("%w: missing solution size", errInvalidZcashHeader)
+	}
+	size := 1
+	switch b[0] {
+	case 0xfd:
+		size = 3
+	case 0xfe:
+		size = 5
+	case 0xff:
+		size = 9
+	}
+	if len(b) < size {
+		return 0, 0, fmt.Errorf("%w: truncated solution size", errInvalidZcashHeader)
+	}
+	switch size {
+	case 3:
+		return uint64(binary.LittleEndian.Uint16(b[1:3])), size, nil
+	case 5:
+		return uint64(binary.LittleEndian.Uint32(b[1:5])), size, nil
+	case 9:
+		return binary.LittleEndian.Uint64(b[1:9]), size, nil
+	default:
+		return uint64(b[0]), size, nil
+	}
+}
+
+// Hash returns the double SHA256 of the serialized header
+func (h *zcashHeader) Hash() [32]byte {
+	first := sha256.Sum256(h.raw)
+	return sha256.Sum256(first[:])
+}
+
+// Target returns the target encoded in the compact Bits field
+func (h *zcashHeader) Target() (*big.Int, error) {
+	exponent := uint(h.Bits >> 24)
+	mantissa := int64(h.Bits & 0x007fffff)
+	if h.Bits&0x00800000 != 0 || mantissa == 0 {
+		return nil, fmt.Errorf("%w: invalid bits %08x", errInvalidZcashHeader, h.Bits)
+	}
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		return target.Rsh(target, 8*(3-exponent)), nil
+	}
+	return target.Lsh(target, 8*(exponent-3)), nil
+}
+
+// VerifyWork returns nil iff the header hash is below its target and its
+// Equihash([n], [k]) solution is valid
+func (h *zcashHeader) VerifyWork(n int, k int) error {
+	target, err := h.Target()
+	if err != nil {
+		return err
+	}
+	hash := h.Hash()
+	if hashToBig(hash).Cmp(target) > 0 {
+		return errInsufficientWork
+	}
+	return verifyEquihash(n, k, h.raw[:zcashHeaderPrefixLen], h.Solution)
+}
+
+// headerCheck is a field of a Zcash block and its value in the header
+type headerCheck struct {
+	field    string
+	header   string
+	attested string
+}
+
+// Matches returns an error if the header doesn't commit to the fields of
+// [zblock]. The final Sapling root is only committed to by the header below
+// Heartwood.
+func (h *zcashHeader) Matches(zblock *ZcashBlock) error {
+	checks := []headerCheck{
+		{"hash", hashToHex(h.Hash()), zblock.Hash},
+		{"version", strconv.Itoa(int(h.Version)), strconv.Itoa(zblock.Version)},
+		{"previousblockhash", hashToHex(h.PrevBlockHash), zblock.PreviousBlockHash},
+		{"merkleroot", hashToHex(h.MerkleRoot), zblock.MerkleRoot},
+		{"blockcommitments", hashToHex(h.BlockCommitments), zblock.BlockCommitments},
+		{"time", strconv.FormatUint(uint64(h.Time), 10), strconv.Itoa(zblock.Time)},
+		{"bits", fmt.Sprintf("%08x", h.Bits), zblock.Bits},
+		{"nonce", hashToHex(h.Nonce), zblock.Nonce},
+		{"solution", hex.EncodeToString(h.Solution), zblock.Solution},
+	}
+	if zblock.Height < heartwoodHeight {
+		checks = append(checks, headerCheck{"finalsaplingroot", hashToHex(h.BlockCommitments), zblock.FinalSaplingRoot})
+	}
+	for _, check := range checks {
+		// the genesis block has no previous block
+		if check.field == "previousblockhash" && check.attested == "" && h.PrevBlockHash == [32]byte{} {
+			continue
+		}
+		if check.header != check.attested {
+			return fmt.Errorf("%w: %s is %q in the header but %q in the block", errHeaderMismatch, check.field, check.header, check.attested)
+		}
+	}
+	return nil
+}
+
+// hashToHex returns the display form of a hash, which reverses its byte order
+func hashToHex(hash [32]byte) string {
+	reversed := reverseHash(hash)
+	return hex.EncodeToString(reversed[:])
+}
+
+// hashToBig interprets [hash] as a little endian 256 bit integer
+func hashToBig(hash [32]byte) *big.Int {
+	reversed := reverseHash(hash)
+	return new(big.Int).SetBytes(reversed[:])
+}
+
+func reverseHash(hash [32]byte) [32]byte {
+	for i := 0; i < len(hash)/2; i++ {
+		hash[i], hash[len(hash)-1-i] = hash[len(hash)-1-i], hash[i]
+	}
+	return hash
+}
+
+// verifyZcashHeader checks that [raw] is a valid header of [zblock]
+func verifyZcashHeader(raw []byte, zblock *ZcashBlock, n int, k int) error {
+	header, err := parseZcashHeader(raw)
+	if err != nil {
+		return err
+	}
+	if err := header.Matches(zblock); err != nil {
+		return err
+	}
+	return header.VerifyWork(n, k)
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"encoding/binary"
+
+	"github.com/ava-labs/avalanchego/database"
+	"github.com/ava-labs/avalanchego/ids"
+)
+
+var _ ZcashIndex = &zcashIndex{}
+
+// ZcashIndex maps the attested Zcash blocks and their transactions to the ID
+// of the accepted block attesting them. If a Zcash block or transaction was
+// attested more than once, the latest attestation is indexed.
+type ZcashIndex interface {
+	GetBlockIDByZcashHeight(height uint64) (ids.ID, error)
+	GetBlockIDByZcashHash(hash string) (ids.ID, error)
+	GetBlockIDByZcashTx(txID string) (ids.ID, error)
+	// GetZcashRange returns up to [limit] attested Zcash heights within
+	// [start, end] in ascending order, with the blocks attesting them
+	GetZcashRange(start, end uint64, limit int) ([]uint64, []ids.ID, error)
+	PutZcashBlock(zblock *ZcashBlock, blkID ids.ID) error
+	PutZcashTxs(zblock *ZcashBlock, blkID ids.ID) error
+}
+
+type zcashIndex struct {
+	// Zcash height --> block ID
+	heightDB database.Database
+	// Zcash hash --> block ID
+	hashDB database.Database
+	// Zcash transaction ID --> block ID
+	txDB database.Database
+}
+
+// NewZcashIndex returns a ZcashIndex storing its entries in [heightDB],
+// [hashDB] and [txDB]
+func NewZcashIndex(heightDB database.Database, hashDB database.Database, txDB database.Database) ZcashIndex {
+	return &zcashIndex{
+		heightDB: heightDB,
+		hashDB:   hashDB,
+		txDB:     txDB,
+	}
+}
+
+// GetBlockIDByZcashHeight returns the ID of the block attesting the Zcash
+// block at [height], or database.ErrNotFound
+func (s *zcashIndex) GetBlockIDByZcashHeight(height uint64) (ids.ID, error) {
+	return getID(s.heightDB, heightKey(height))
+}
+
+// GetBlockIDByZcashHash returns the ID of the block attesting the Zcash block
+// with hash [hash], or database.ErrNotFound
+func (s *zcashIndex) GetBlockIDByZcashHash(hash string) (ids.ID, error) {
+	return getID(s.hashDB, []byte(hash))
+}
+
+// GetBlockIDByZcashTx returns the ID of the block attesting the Zcash block
+// that includes the transaction [txID], or database.ErrNotFound
+func (s *zcashIndex) GetBlockIDByZcashTx(txID string) (ids.ID, error) {
+	return getID(s.txDB, []byte(txID))
+}
+
+func (s *zcashIndex) GetZcashRange(start, end uint64, limit int) ([]uint64, []ids.ID, error) {
+	it := s.heightDB.NewIteratorWithStart(heightKey(start))
+	defer it.Release()
+
+	var (
+		heights []uint64
+		blkIDs  []ids.ID
+	)
+	for len(heights) < limit && it.Next() {
+		height := binary.BigEndian.Uint64(it.Key())
+		if height > end {
+			break
+		}
+		blkID, err := ids.ToID(it.Value())
+		if err != nil {
+			return nil, nil, err
+		}
+		heights = append(heights, height)
+		blkIDs = append(blkIDs, blkID)
+	}
+	return heights, blkIDs, it.Error()
+}
+
+// PutZcashBlock indexes [zblock] as attested by the block [blkID]
+func (s *zcashIndex) PutZcashBlock(zblock *ZcashBlock, blkID ids.ID) error {
+	if err := s.heightDB.Put(heightKey(uint64(zblock.Height)), blkID[:]); err != nil {
+		return err
+	}
+	if err := s.hashDB.Put([]byte(zblock.Hash), blkID[:]); err != nil {
+		return err
+	}
+	return s.PutZcashTxs(zblock, blkID)
+}
+
+// PutZcashTxs indexes the transactions of [zblock] as attested by the block
+// [blkID]
+func (s *zcashIndex) PutZcashTxs(zblock *ZcashBlock, blkID ids.ID) error {
+	for _, txID := range zblock.Tx {
+		if err := s.txDB.Put([]byte(txID), blkID[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heightKey returns the big endian encoding of [height], so that keys
+// iterate in height order
+func heightKey(height uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, height)
+}
+
+func getID(db database.KeyValueReader, key []byte) (ids.ID, error) {
+	idBytes, err := db.Get(key)
+	if err != nil {
+		return ids.Empty, err
+	}
+	return ids.ToID(idBytes)
+}
@@ -0,0 +1,252 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	log "github.com/inconshreveable/log15"
+)
+
+const (
+	dissentMismatch = "mismatch"
+	dissentError    = "error"
+)
+
+var (
+	errNoZcashQuorum = errors.New("zcash endpoints did not reach quorum")
+
+	_ ZcashSource = &quorumZcashSource{}
+)
+
+// ZcashEndpoint is a single zcashd queried by the quorum source
+type ZcashEndpoint struct {
+	// Name identifies the endpoint in logs and metrics. Defaults to the host
+	// of Url.
+	Name string `serialize:"true" json:"name"`
+	Url  string `serialize:"true" json:"url"`
+
+	ZcashCredentials
+}
+
+// name returns the label used for this endpoint in logs and metrics
+func (e *ZcashEndpoint) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	if u, err := url.Parse(e.Url); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return e.Url
+}
+
+type namedZcashSource struct {
+	name string
+	ZcashSource
+}
+
+// quorumZcashSource queries every endpoint in parallel and only returns a
+// result that at least [threshold] endpoints agree on. Endpoints that fail or
+// disagree with the accepted result are logged and counted in metrics.
+type quorumZcashSource struct {
+	sources   []namedZcashSource
+	threshold int
+	metrics   *metrics
+}
+
+// newQuorumZcashSource returns a ZcashSource requiring [threshold] of
+// [sources] to agree
+func newQuorumZcashSource(sources []namedZcashSource, threshold int, metrics *metrics) ZcashSource {
+	return &quorumZcashSource{
+		sources:   sources,
+		threshold: threshold,
+		metrics:   metrics,
+	}
+}
+
+// quorumResponse is the reply of a single endpoint. Responses with equal keys
+// are considered to agree.
+type quorumResponse struct {
+	value interface{}
+	key   string
+	err   error
+}
+
+// GetBlockCount returns the highest tip that at least [threshold] endpoints
+// have reached. Endpoints are expected to be at slightly different heights,
+// so only failures are reported as dissent.
+func (q *quorumZcashSource) GetBlockCount(ctx context.Context) (uint64, error) {
+	const method = "getblockcount"
+	responses := q.queryAll(ctx, func(ctx context.Context, src ZcashSource) quorumResponse {
+		count, err := src.GetBlockCount(ctx)
+		return quorumResponse{value: count, err: err}
+	})
+
+	counts := make([]uint64, 0, len(responses))
+	for i, resp := range responses {
+		if resp.err != nil {
+			q.reportDissent(method, i, dissentError, resp.err)
+			continue
+		}
+		counts = append(counts, resp.value.(uint64))
+	}
+	if len(counts) == 0 {
+		return 0, fmt.Errorf("%w: %w", errNoZcashQuorum, errZcashUnavailable)
+	}
+	if len(counts) < q.threshold {
+		return 0, fmt.Errorf("%w: %s answered by %d of %d endpoints", errNoZcashQuorum, method, len(counts), q.threshold)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i] > counts[j] })
+	return counts[q.threshold-1], nil
+}
+
+func (q *quorumZcashSource) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	value, err := q.agree(ctx, "getblockhash", func(ctx context.Context, src ZcashSource) quorumResponse {
+		hash, err := src.GetBlockHash(ctx, height)
+		return quorumResponse{value: hash, key: hash, err: err}
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (q *quorumZcashSource) GetBlock(ctx context.Context, hash string) (*ZcashBlock, error) {
+	value, err := q.agree(ctx, "getblock", func(ctx context.Context, src ZcashSource) quorumResponse {
+		block, err := src.GetBlock(ctx, hash)
+		if err != nil {
+			return quorumResponse{err: err}
+		}
+		key, err := blockFingerprint(block)
+		return quorumResponse{value: block, key: key, err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*ZcashBlock), nil
+}
+
+func (q *quorumZcashSource) GetBlockHeader(ctx context.Context, hash string) ([]byte, error) {
+	value, err := q.agree(ctx, "getblockheader", func(ctx context.Context, src ZcashSource) quorumResponse {
+		header, err := src.GetBlockHeader(ctx, hash)
+		return quorumResponse{value: header, key: string(header), err: err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+func (q *quorumZcashSource) GetRawTransaction(ctx context.Context, txID string) (string, error) {
+	value, err := q.agree(ctx, "getrawtransaction", func(ctx context.Context, src ZcashSource) quorumResponse {
+		rawTx, err := src.GetRawTransaction(ctx, txID)
+		return quorumResponse{value: rawTx, key: rawTx, err: err}
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// agree returns the value that at least [threshold] endpoints replied with
+func (q *quorumZcashSource) agree(
+	ctx context.Context,
+	method string,
+	fetch func(context.Context, ZcashSource) quorumResponse,
+) (interface{}, error) {
+	responses := q.queryAll(ctx, fetch)
+
+	votes := make(map[string]int)
+	for _, resp := range responses {
+		if resp.err == nil {
+			votes[resp.key]++
+		}
+	}
+
+	var (
+		winner      string
+		winnerVotes int
+		quorums     int
+	)
+	for key, count := range votes {
+		if count > winnerVotes {
+			winner, winnerVotes = key, count
+		}
+		if count >= q.threshold {
+			quorums++
+		}
+	}
+	// With a threshold below a majority, two conflicting answers can both
+	// reach it. Neither can be trusted in that case.
+	if quorums > 1 {
+		return nil, fmt.Errorf("%w: %s has %d conflicting answers", errNoZcashQuorum, method, quorums)
+	}
+
+	var value interface{}
+	for i, resp := range responses {
+		switch {
+		case resp.err != nil:
+			q.reportDissent(method, i, dissentError, resp.err)
+		case resp.key != winner:
+			q.reportDissent(method, i, dissentMismatch, nil)
+		default:
+			value = resp.value
+		}
+	}
+
+	if winnerVotes == 0 {
+		return nil, fmt.Errorf("%w: %w", errNoZcashQuorum, errZcashUnavailable)
+	}
+	if winnerVotes < q.threshold {
+		return nil, fmt.Errorf("%w: %s agreed on by %d of %d endpoints", errNoZcashQuorum, method, winnerVotes, q.threshold)
+	}
+	return value, nil
+}
+
+// queryAll calls [fetch] on every endpoint in parallel
+func (q *quorumZcashSource) queryAll(
+	ctx context.Context,
+	fetch func(context.Context, ZcashSource) quorumResponse,
+) []quorumResponse {
+	responses := make([]quorumResponse, len(q.sources))
+	wg := sync.WaitGroup{}
+	for i, src := range q.sources {
+		wg.Add(1)
+		go func(i int, src ZcashSource) {
+			defer wg.Done()
+			responses[i] = fetch(ctx, src)
+		}(i, src)
+	}
+	wg.Wait()
+	return responses
+}
+
+func (q *quorumZcashSource) reportDissent(method string, i int, reason string, err error) {
+	name := q.sources[i].name
+	log.Warn("zcash endpoint dissented from quorum",
+		"endpoint", name,
+		"method", method,
+		"reason", reason,
+		"err", err,
+	)
+	if q.metrics != nil {
+		q.metrics.zcashEndpointDissents.WithLabelValues(name, method, reason).Inc()
+	}
+}
+
+// blockFingerprint returns a key identifying the content of [block],
+// ignoring the fields that naturally differ between nodes
+func blockFingerprint(block *ZcashBlock) (string, error) {
+	stable := *block
+	stable.Confirmations = 0
+	stable.NextBlockHash = ""
+	fingerprint, err := json.Marshal(&stable)
+	return string(fingerprint), err
+}
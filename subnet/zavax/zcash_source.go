@@ -0,0 +1,254 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// zcashd reports this RPC error code while it is still starting up
+const rpcInWarmup = -28
+
+// upper bound of the delay between two retries
+const maxZcashRetryBackoff = 5 * time.Second
+
+var (
+	errZcashEmptyResult = errors.New("zcash node returned an empty result")
+	errZcashTransient   = errors.New("transient zcash error")
+
+	_ ZcashSource = &rpcZcashSource{}
+)
+
+// ZcashSource provides read access to the Zcash chain. The VM only talks to
+// Zcash through this interface so the backend can be swapped or faked.
+type ZcashSource interface {
+	// GetBlockCount returns the height of the current Zcash tip
+	GetBlockCount(ctx context.Context) (uint64, error)
+	// GetBlockHash returns the hash of the block at [height]
+	GetBlockHash(ctx context.Context, height uint64) (string, error)
+	// GetBlock returns the decoded block with [hash]
+	GetBlock(ctx context.Context, hash string) (*ZcashBlock, error)
+	// GetBlockHeader returns the serialized header of the block with [hash]
+	GetBlockHeader(ctx context.Context, hash string) ([]byte, error)
+	// GetRawTransaction returns the hex encoded transaction with [txID]
+	GetRawTransaction(ctx context.Context, txID string) (string, error)
+}
+
+// newZcashSource returns the ZcashSource described by [config]. If multiple
+// endpoints are configured, their answers must reach the configured quorum.
+func newZcashSource(config *Config, metrics *metrics) ZcashSource {
+	if len(config.ZcashEndpoints) == 0 {
+		endpoint := ZcashEndpoint{Url: config.Url}
+		src := NewRPCZcashSource(config.Url, config.ZcashCredentials, config.ZcashClientConfig)
+		return newMeteredZcashSource(src, endpoint.name(), metrics)
+	}
+
+	sources := make([]namedZcashSource, len(config.ZcashEndpoints))
+	for i, endpoint := range config.ZcashEndpoints {
+		src := NewRPCZcashSource(endpoint.Url, endpoint.ZcashCredentials, config.ZcashClientConfig)
+		sources[i] = namedZcashSource{
+			name:        endpoint.name(),
+			ZcashSource: newMeteredZcashSource(src, endpoint.name(), metrics),
+		}
+	}
+	return newQuorumZcashSource(sources, config.quorum(), metrics)
+}
+
+// rpcError is the error object returned by zcashd's JSON-RPC interface
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("zcash rpc error %d: %s", e.Code, e.Message)
+}
+
+// rpcZcashSource implements ZcashSource against a zcashd JSON-RPC endpoint.
+// Transient failures are retried and repeated failures trip a circuit
+// breaker, after which calls fail fast with errZcashUnavailable.
+type rpcZcashSource struct {
+	url         string
+	credentials ZcashCredentials
+	config      ZcashClientConfig
+	client      *http.Client
+	breaker     *circuitBreaker
+}
+
+// NewRPCZcashSource returns a ZcashSource backed by the zcashd at [url],
+// authenticating with [credentials]
+func NewRPCZcashSource(url string, credentials ZcashCredentials, config ZcashClientConfig) ZcashSource {
+	return &rpcZcashSource{
+		url:         url,
+		credentials: credentials,
+		config:      config,
+		client:      &http.Client{},
+		breaker:     newCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown.Duration),
+	}
+}
+
+func (s *rpcZcashSource) GetBlockCount(ctx context.Context) (uint64, error) {
+	var count uint64
+	if err := s.call(ctx, "getblockcount", []interface{}{}, &count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *rpcZcashSource) GetBlockHash(ctx context.Context, height uint64) (string, error) {
+	var hash string
+	if err := s.call(ctx, "getblockhash", []interface{}{height}, &hash); err != nil {
+		return "", err
+	}
+	if hash == "" {
+		return "", errZcashEmptyResult
+	}
+	return hash, nil
+}
+
+func (s *rpcZcashSource) GetBlock(ctx context.Context, hash string) (*ZcashBlock, error) {
+	var block *ZcashBlock
+	if err := s.call(ctx, "getblock", []interface{}{hash}, &block); err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errZcashEmptyResult
+	}
+	return block, nil
+}
+
+func (s *rpcZcashSource) GetBlockHeader(ctx context.Context, hash string) ([]byte, error) {
+	var header string
+	if err := s.call(ctx, "getblockheader", []interface{}{hash, false}, &header); err != nil {
+		return nil, err
+	}
+	if header == "" {
+		return nil, errZcashEmptyResult
+	}
+	return hex.DecodeString(header)
+}
+
+func (s *rpcZcashSource) GetRawTransaction(ctx context.Context, txID string) (string, error) {
+	var rawTx string
+	if err := s.call(ctx, "getrawtransaction", []interface{}{txID, 0}, &rawTx); err != nil {
+		return "", err
+	}
+	if rawTx == "" {
+		return "", errZcashEmptyResult
+	}
+	return rawTx, nil
+}
+
+// call sends a JSON-RPC request for [method] and decodes the result into
+// [result], retrying transient failures with an exponential backoff
+func (s *rpcZcashSource) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	if err := s.breaker.allow(); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	backoff := s.config.RetryBackoff.Duration
+	for attempt := 0; ; attempt++ {
+		err := s.callOnce(ctx, method, params, result)
+		switch {
+		case err == nil || !errors.Is(err, errZcashTransient):
+			// zcashd answered, even if it was with an error
+			s.breaker.success()
+			return err
+		case ctx.Err() != nil:
+			// the caller gave up, which says nothing about zcashd
+			s.breaker.abort()
+			return fmt.Errorf("%s: %w", method, ctx.Err())
+		case attempt >= s.config.MaxRetries:
+			s.breaker.failure()
+			return fmt.Errorf("%s failed after %d attempts: %w", method, attempt+1, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.breaker.abort()
+			return fmt.Errorf("%s: %w", method, ctx.Err())
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxZcashRetryBackoff)
+	}
+}
+
+// callOnce sends a single JSON-RPC request for [method]. Failures that are
+// worth retrying wrap errZcashTransient.
+func (s *rpcZcashSource) callOnce(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      Name,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.config.RequestTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.RequestTimeout.Duration)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if err := s.credentials.apply(req); err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %w", errZcashTransient, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errZcashTransient, err)
+	}
+
+	// zcashd replies with a non-200 status for RPC level errors, but still
+	// includes the error object in the body, so try to decode it first.
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		err = fmt.Errorf("%s: unexpected response (status %d): %w", method, resp.StatusCode, err)
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %w", errZcashTransient, err)
+		}
+		return err
+	}
+	if response.Error != nil {
+		if response.Error.Code == rpcInWarmup {
+			return fmt.Errorf("%w: %s: %w", errZcashTransient, method, response.Error)
+		}
+		return fmt.Errorf("%s: %w", method, response.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", method, resp.StatusCode)
+	}
+	return json.Unmarshal(response.Result, result)
+}
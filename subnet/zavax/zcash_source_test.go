@@ -0,0 +1,210 @@
+// Copyright (C) 2019-2023, Ava Labs, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package zavax
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestZcashd returns a server answering getblockcount with [tip] and
+// recording the Basic auth credentials of the last request
+func newTestZcashd(t *testing.T, tip uint64) (*httptest.Server, *[2]string) {
+	lastAuth := &[2]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		*lastAuth = [2]string{user, password}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": tip,
+			"error":  nil,
+		}))
+	}))
+	t.Cleanup(server.Close)
+	return server, lastAuth
+}
+
+func TestRPCZcashSourceCredentials(t *testing.T) {
+	dir := t.TempDir()
+	cookieFile := filepath.Join(dir, ".cookie")
+	require.NoError(t, os.WriteFile(cookieFile, []byte("__cookie__:abc123\n"), 0o600))
+	passwordFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("from-file\n"), 0o600))
+	t.Setenv("ZAVAX_TEST_RPC_PASSWORD", "from-env")
+
+	tests := []struct {
+		name        string
+		credentials ZcashCredentials
+		expected    [2]string
+	}{
+		{
+			name:        "none",
+			credentials: ZcashCredentials{},
+			expected:    [2]string{"", ""},
+		},
+		{
+			name:        "literal",
+			credentials: ZcashCredentials{User: "user", Password: "password"},
+			expected:    [2]string{"user", "password"},
+		},
+		{
+			name:        "env",
+			credentials: ZcashCredentials{User: "user", PasswordEnv: "ZAVAX_TEST_RPC_PASSWORD"},
+			expected:    [2]string{"user", "from-env"},
+		},
+		{
+			name:        "file",
+			credentials: ZcashCredentials{User: "user", Password: "ignored", PasswordFile: passwordFile},
+			expected:    [2]string{"user", "from-file"},
+		},
+		{
+			name:        "cookie",
+			credentials: ZcashCredentials{CookieFile: cookieFile},
+			expected:    [2]string{"__cookie__", "abc123"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			server, lastAuth := newTestZcashd(t, 42)
+			src := NewRPCZcashSource(server.URL, test.credentials, ZcashClientConfig{})
+			tip, err := src.GetBlockCount(context.Background())
+			require.NoError(err)
+			require.Equal(uint64(42), tip)
+			require.Equal(test.expected, *lastAuth)
+		})
+	}
+}
+
+func TestZcashCredentialsErrors(t *testing.T) {
+	require := require.New(t)
+
+	conflicting := ZcashCredentials{User: "user", CookieFile: "/tmp/.cookie"}
+	require.ErrorIs(conflicting.Verify(), errConflictingCredentials)
+
+	missingEnv := ZcashCredentials{PasswordEnv: "ZAVAX_TEST_UNSET_VARIABLE"}
+	_, _, _, err := missingEnv.resolve()
+	require.ErrorIs(err, errMissingEnvVar)
+
+	malformed := filepath.Join(t.TempDir(), ".cookie")
+	require.NoError(os.WriteFile(malformed, []byte("no-separator"), 0o600))
+	_, _, _, err = (&ZcashCredentials{CookieFile: malformed}).resolve()
+	require.ErrorIs(err, errMalformedCookie)
+}
+
+func TestQuorumZcashSource(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	honest1 := newTestZcashSource(10)
+	honest2 := newTestZcashSource(12)
+	forked := newTestZcashSource(11)
+	forked.blocks[5] = &ZcashBlock{Hash: "forked", Height: 5}
+
+	registry := prometheus.NewRegistry()
+	m, err := newMetrics(registry)
+	require.NoError(err)
+	src := newQuorumZcashSource([]namedZcashSource{
+		{name: "honest1", ZcashSource: honest1},
+		{name: "honest2", ZcashSource: honest2},
+		{name: "forked", ZcashSource: forked},
+	}, 2, m)
+
+	// The second highest tip is reached by two endpoints
+	tip, err := src.GetBlockCount(ctx)
+	require.NoError(err)
+	require.Equal(uint64(11), tip)
+
+	hash, err := src.GetBlockHash(ctx, 5)
+	require.NoError(err)
+	require.Equal(honest1.blocks[5].Hash, hash)
+	require.Equal(1.0, testutil.ToFloat64(m.zcashEndpointDissents.WithLabelValues("forked", "getblockhash", dissentMismatch)))
+
+	// Only one endpoint knows height 12
+	_, err = src.GetBlockHash(ctx, 12)
+	require.ErrorIs(err, errNoZcashQuorum)
+}
+
+func TestRPCZcashSourceRetries(t *testing.T) {
+	require := require.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests <= 2 {
+			// zcashd is still loading its block index
+			w.WriteHeader(http.StatusInternalServerError)
+			require.NoError(json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": nil,
+				"error":  map[string]interface{}{"code": rpcInWarmup, "message": "Loading block index..."},
+			}))
+			return
+		}
+		require.NoError(json.NewEncoder(w).Encode(map[string]interface{}{"result": 7}))
+	}))
+	defer server.Close()
+
+	src := NewRPCZcashSource(server.URL, ZcashCredentials{}, ZcashClientConfig{
+		MaxRetries:   2,
+		RetryBackoff: Duration{time.Millisecond},
+	})
+	tip, err := src.GetBlockCount(context.Background())
+	require.NoError(err)
+	require.Equal(uint64(7), tip)
+	require.Equal(3, requests)
+}
+
+func TestRPCZcashSourceCircuitBreaker(t *testing.T) {
+	require := require.New(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	src := NewRPCZcashSource(server.URL, ZcashCredentials{}, ZcashClientConfig{
+		BreakerThreshold: 2,
+		BreakerCooldown:  Duration{time.Hour},
+	})
+	for i := 0; i < 2; i++ {
+		_, err := src.GetBlockCount(context.Background())
+		require.ErrorIs(err, errZcashTransient)
+	}
+	require.Equal(2, requests)
+
+	// The breaker is open, so zcashd is not contacted anymore
+	_, err := src.GetBlockCount(context.Background())
+	require.ErrorIs(err, errZcashUnavailable)
+	require.Equal(2, requests)
+}
+
+func TestRPCZcashSourceTimeout(t *testing.T) {
+	require := require.New(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	src := NewRPCZcashSource(server.URL, ZcashCredentials{}, ZcashClientConfig{
+		RequestTimeout: Duration{10 * time.Millisecond},
+	})
+	_, err := src.GetBlockCount(context.Background())
+	require.ErrorIs(err, errZcashTransient)
+	require.ErrorIs(err, context.DeadlineExceeded)
+}
@@ -33,6 +33,9 @@ app.post("/api/height", async (req, res) => {
   }
 });
 
+// Waits up to WAIT_TIMEOUT for the block to be attested when it isn't yet
+const WAIT_TIMEOUT = "30s";
+
 const getBlockHeight = async (req) => {
   const { node, block } = req;
   const url = node;
@@ -41,6 +44,8 @@ const getBlockHeight = async (req) => {
     method: "zavax.getBlockByHeight",
     params: {
       id: block,
+      wait: true,
+      timeout: WAIT_TIMEOUT,
     },
     id: 1,
   };
@@ -51,38 +56,9 @@ const getBlockHeight = async (req) => {
   return response;
 };
 
-const sleep = (ms) => {
-  return new Promise((resolve) => setTimeout(resolve, ms));
-};
-
 app.post("/api/block", async (req, res) => {
   try {
-    let response = await getBlockHeight(req.body);
-    if (response?.data?.error || response?.data?.result?.data?.height === req.body.block) {
-      res.json(response?.data ?? {});
-      return
-    } 
-    const block = await getBlock(req);
-    const { data: { result:{ height: lastBlockHeight } } } = block;
-    
-    for (let i = 0; i < 12; i++) {
-      response = await getBlock(req)
-      if (response?.data?.error) break;
-      if (response?.data?.result?.data?.height === req.body.block) {
-        break;
-      } else {
-        if(response?.data?.result?.height > lastBlockHeight){
-          if (response?.data?.result?.data?.height === req.body.block) {
-            break;
-          }else{            
-            req.lastBlockId =  response?.data?.result?.parentID || null
-          }
-        } else{
-          req.lastBlockId = null
-        }
-        await sleep(2000);        
-      }
-    }
+    const response = await getBlockHeight(req.body);
     res.json(response?.data ?? {});
   } catch (error) {
     console.error(error)
@@ -90,27 +66,55 @@ app.post("/api/block", async (req, res) => {
   }
 });
 
-const verifyBlocks = async (req) => {
-  const { node } = req;
-  const url = node;
+// Delay between two polls of a reconcile job
+const RECONCILE_POLL_INTERVAL = 2000;
+
+const callReconcile = async (node, method, params) => {
   const requestBody = {
     jsonrpc: "2.0",
-    method: "zavax.reconcileBlocks",
-    params: {},
+    method,
+    params,
     id: 1,
   };
 
-  const response = await axios.post(url, requestBody, {
+  const response = await axios.post(node, requestBody, {
     httpsAgent: new https.Agent({ rejectUnauthorized: false }),
   });
-  return response;
+  if (response?.data?.error) {
+    throw new Error(response.data.error.message);
+  }
+  return response.data.result;
+};
+
+// Starts a reconcile job, or joins the one already running, and polls it
+// until it stops instead of holding a request open on the node
+const verifyBlocks = async (req) => {
+  const { node } = req;
+  let job;
+  try {
+    job = await callReconcile(node, "zavax.startReconcile", {});
+  } catch (error) {
+    // no attested Zcash block is old enough to check
+    if (error.message.startsWith("invalid zcash height range")) {
+      return [];
+    }
+    throw error;
+  }
+  while (job.status === "running") {
+    await new Promise((resolve) => setTimeout(resolve, RECONCILE_POLL_INTERVAL));
+    job = await callReconcile(node, "zavax.getReconcileJob", { jobID: job.jobID });
+  }
+  if (job.status !== "completed") {
+    throw new Error(`reconcile job ${job.jobID} is ${job.status}: ${job.error}`);
+  }
+  const report = await callReconcile(node, "zavax.getReconcileReport", { jobID: job.jobID });
+  return report?.height ?? [];
 };
 
 app.post("/api/verify", async (req, res) => {
   try {
-    let response;
-    response = await verifyBlocks(req.body);
-    res.json(response?.data?.result?.height ?? []);
+    const height = await verifyBlocks(req.body);
+    res.json(height);
   } catch (error) {
     console.error(error)
     res.status(500).json({ error: "connection timeout" });